@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/akinbezatoglu/s3ync/pkg/config"
@@ -9,13 +10,22 @@ import (
 type Config interface {
 	GetProfileNames() ([]string, error)
 	GetSyncListFromProfile(profile string) ([]string, error)
-	AddSync(profile, path, bucketname, bucketregion string) error
+	AddSync(backend, profile, path, bucketname, bucketregion string, options ...SyncOption) error
 	RemoveSync(profile, path string) error
 	Write() error
 	Set(keys []string, value string)
 	GetConfigFilePath() string
+	GetConfigDir() string
 	GetRegionFromProfile(profile string) (string, error)
 	IsProfileExistInConfigFile(p string) bool
+	IsBackendProfileExist(backend, p string) bool
+	SetProfilePaused(profile string, paused bool) error
+}
+
+// SyncOption is a setting of a sync, written under its entry with AddSync.
+type SyncOption struct {
+	Keys  []string // ex. ["encryption", "type"]
+	Value string
 }
 
 type cfg struct {
@@ -34,10 +44,15 @@ func (c *cfg) GetConfigFilePath() string {
 	return config.GeneralConfigFile()
 }
 
+func (c *cfg) GetConfigDir() string {
+	return config.ConfigDir()
+}
+
 func (c *cfg) Write() error {
 	return config.Write(c.cfg)
 }
 
+// IsProfileExistInConfigFile reports whether the profile is in the config file, the profile of any backend.
 func (c *cfg) IsProfileExistInConfigFile(p string) bool {
 	profiles, _ := c.GetProfileNames()
 	for _, profile := range profiles {
@@ -48,94 +63,183 @@ func (c *cfg) IsProfileExistInConfigFile(p string) bool {
 	return false
 }
 
+// IsBackendProfileExist reports whether the profile of a backend is in the config file,
+// ex. the aws profiles of s3.profiles or the storage accounts of blob.profiles.
+func (c *cfg) IsBackendProfileExist(backend, p string) bool {
+	profiles, _ := c.cfg.Keys([]string{backend, "profiles"})
+	for _, profile := range profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSections are the sections of the config file whose profiles have syncs. The syncs of the local backend
+// are in the s3 section, their profile only groups them.
+var syncSections = []string{"s3", "blob", "gcp"}
+
+// syncSection returns the section of the config file the syncs of the backend are listed in.
+func syncSection(backend string) string {
+	for _, section := range syncSections {
+		if section == backend {
+			return section
+		}
+	}
+	return "s3"
+}
+
+// GetProfileNames returns the profiles of every backend that may have syncs.
 func (c *cfg) GetProfileNames() ([]string, error) {
-	return c.cfg.Keys([]string{"s3", "profiles"})
+	var x []string
+	seen := make(map[string]bool)
+	for _, section := range syncSections {
+		profiles, err := c.cfg.Keys([]string{section, "profiles"})
+		var notFound *config.KeyNotFoundError
+		if errors.As(err, &notFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range profiles {
+			if !seen[p] {
+				seen[p] = true
+				x = append(x, p)
+			}
+		}
+	}
+	return x, nil
 }
 
 func (c *cfg) GetRegionFromProfile(profile string) (string, error) {
 	return c.cfg.Get([]string{"s3", "profiles", profile, "region"})
 }
 
+// GetSyncListFromProfile returns the local path and the bucket of every sync of the profile,
+// the syncs of the profile in every backend.
 func (c *cfg) GetSyncListFromProfile(profile string) ([]string, error) {
-	idx, err := c.cfg.Keys([]string{"s3", "profiles", profile, "syncs"})
-	if err != nil {
-		return nil, err
-	}
-	if len(idx) == 0 {
-		return nil, nil
-	}
 	var x []string
-	for _, i := range idx {
-		local, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", i, "local"})
-		if err != nil {
-			return nil, err
+	found := false
+	var notFound *config.KeyNotFoundError
+	for _, section := range syncSections {
+		if !c.IsBackendProfileExist(section, profile) {
+			continue
+		}
+		found = true
+		// The profiles of the other backends have no syncs entry until their first sync is added.
+		idx, err := c.cfg.Keys([]string{section, "profiles", profile, "syncs"})
+		if errors.As(err, &notFound) {
+			continue
 		}
-		bucket, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", i, "bucket", "name"})
 		if err != nil {
 			return nil, err
 		}
-		x = append(x, local, bucket)
+		for _, i := range idx {
+			local, err := c.cfg.Get([]string{section, "profiles", profile, "syncs", i, "local"})
+			if err != nil {
+				return nil, err
+			}
+			bucket, err := c.cfg.Get([]string{section, "profiles", profile, "syncs", i, "bucket", "name"})
+			if err != nil {
+				return nil, err
+			}
+			x = append(x, local, bucket)
+		}
+	}
+	if !found {
+		return nil, &config.KeyNotFoundError{Key: profile}
 	}
 	return x, nil
 }
 
-func (c *cfg) AddSync(profile, path, bucketname, bucketregion string) error {
-	idx, err := c.cfg.Keys([]string{"s3", "profiles", profile, "syncs"})
-	if err != nil {
+// AddSync adds the sync with its options to the profile of the backend and writes the config file.
+// The options are written with the sync, so the running service never reloads a half-configured sync.
+func (c *cfg) AddSync(backend, profile, path, bucketname, bucketregion string, options ...SyncOption) error {
+	section := syncSection(backend)
+	idx, err := c.cfg.Keys([]string{section, "profiles", profile, "syncs"})
+	var notFound *config.KeyNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
 		return err
 	}
-	c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(len(idx) + 1), "local"}, path)
-	c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(len(idx) + 1), "bucket", "name"}, bucketname)
-	c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(len(idx) + 1), "bucket", "region"}, bucketregion)
-	c.Write()
-	return nil
+	// The syncs of the local backend may have a profile that is not an aws profile, its entry is added.
+	// Removed syncs leave gaps in the keys, so the next key follows the largest one.
+	next := 1
+	for _, i := range idx {
+		if n, err := strconv.Atoi(i); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	keys := []string{section, "profiles", profile, "syncs", strconv.Itoa(next)}
+	c.cfg.Set(append(keys, "local"), path)
+	c.cfg.Set(append(keys, "bucket", "name"), bucketname)
+	c.cfg.Set(append(keys, "bucket", "region"), bucketregion)
+	for _, o := range options {
+		c.cfg.Set(append(keys, o.Keys...), o.Value)
+	}
+	return c.Write()
 }
 
-func (c *cfg) RemoveSync(profile, path string) error {
-	idx, err := c.cfg.Keys([]string{"s3", "profiles", profile, "syncs"})
-	if err != nil {
-		return err
-	}
-	flg := false
-	for l, id := range idx {
-		p, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", id, "local"})
+// findSync returns the keys of the sync entry of the profile whose local path is path.
+func (c *cfg) findSync(profile, path string) ([]string, error) {
+	for _, section := range syncSections {
+		idx, err := c.cfg.Keys([]string{section, "profiles", profile, "syncs"})
 		if err != nil {
-			return err
+			continue
 		}
-		if !flg {
-			if p == path {
-				err := c.cfg.Remove([]string{"s3", "profiles", profile, "syncs", id})
-				if err != nil {
-					return err
-				}
-				if len(idx) == 1 {
-					c.cfg.Set([]string{"s3", "profiles", profile, "syncs"}, "")
-				}
-			}
-			flg = true
-		} else {
-			local, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", id, "local"})
-			if err != nil {
-				return err
-			}
-			bucketname, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", id, "bucket", "name"})
+		for _, id := range idx {
+			local, err := c.cfg.Get([]string{section, "profiles", profile, "syncs", id, "local"})
 			if err != nil {
-				return err
+				return nil, err
 			}
-			bucketregion, err := c.cfg.Get([]string{"s3", "profiles", profile, "syncs", id, "bucket", "region"})
-			if err != nil {
-				return err
-			}
-			c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(l), "local"}, local)
-			c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(l), "bucket", "name"}, bucketname)
-			c.cfg.Set([]string{"s3", "profiles", profile, "syncs", strconv.Itoa(l), "bucket", "region"}, bucketregion)
-			err = c.cfg.Remove([]string{"s3", "profiles", profile, "syncs", id})
-			if err != nil {
-				return err
+			if local == path {
+				return []string{section, "profiles", profile, "syncs", id}, nil
 			}
 		}
 	}
-	c.Write()
+	return nil, &config.KeyNotFoundError{Key: path}
+}
+
+// RemoveSync removes the sync entry of the profile whose local path is path and writes the config file.
+func (c *cfg) RemoveSync(profile, path string) error {
+	keys, err := c.findSync(profile, path)
+	if err != nil {
+		return err
+	}
+	if err := c.cfg.Remove(keys); err != nil {
+		return err
+	}
+	syncs := keys[:len(keys)-1]
+	idx, err := c.cfg.Keys(syncs)
+	if err != nil {
+		return err
+	}
+	if len(idx) == 0 {
+		c.cfg.Set(syncs, "")
+	}
+	return c.Write()
+}
+
+// SetProfilePaused suspends or resumes the syncs of the profile in every backend.
+// It does not write the config file, the caller writes it.
+func (c *cfg) SetProfilePaused(profile string, paused bool) error {
+	for _, section := range syncSections {
+		if !c.IsBackendProfileExist(section, profile) {
+			continue
+		}
+		keys := []string{section, "profiles", profile, "paused"}
+		if paused {
+			c.cfg.Set(keys, "true")
+			continue
+		}
+		if _, err := c.cfg.Get(keys); err != nil {
+			// The profile is not paused.
+			continue
+		}
+		if err := c.cfg.Remove(keys); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,21 @@
+// Package prompt asks the user for confirmation before destructive operations.
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Confirm prints the message and reports whether the user answered yes.
+// Any other answer, including an empty one, is treated as no.
+func Confirm(message string) bool {
+	fmt.Printf("%v [y/N]: ", message)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
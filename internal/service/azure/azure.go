@@ -0,0 +1,314 @@
+// Package azure is the storage backend of the syncs whose bucket is a container of Azure Blob Storage.
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+const (
+	// defaultBlockSize and defaultConcurrency stage the blocks of large blobs when the sync does not set them.
+	defaultBlockSize   = 8 << 20
+	defaultConcurrency = 5
+	// maxBlocks is the most blocks of a block blob, the blocks of very large files are larger than the part size.
+	maxBlocks = 50000
+	// copyPollInterval is the interval between the checks of a copy, blobs are copied asynchronously.
+	copyPollInterval = 500 * time.Millisecond
+)
+
+func init() {
+	storage.RegisterTransient(isTransient)
+}
+
+// isTransient reports whether an operation of a container may succeed when it is tried again:
+// network errors, timeouts, throttling and 5xx responses.
+func isTransient(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Account is a storage account of Azure Blob Storage.
+type Account struct {
+	client *azblob.Client
+}
+
+// NewAccount returns the storage account of the profile, authorized by its connection string,
+// SAS token or shared key.
+func NewAccount(p *config.BlobProfile) (*Account, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" && p.Account != "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", p.Account)
+	}
+	var client *azblob.Client
+	var err error
+	switch {
+	case p.ConnectionString != "":
+		client, err = azblob.NewClientFromConnectionString(p.ConnectionString, nil)
+	case p.SASToken != "":
+		client, err = azblob.NewClientWithNoCredential(strings.TrimSuffix(endpoint, "/")+"/?"+strings.TrimPrefix(p.SASToken, "?"), nil)
+	default:
+		var cred *azblob.SharedKeyCredential
+		if cred, err = azblob.NewSharedKeyCredential(p.Account, p.AccountKey); err == nil {
+			client, err = azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+		}
+	}
+	if err != nil {
+		return nil, &BlobClientFailedError{Err: err}
+	}
+	return &Account{client: client}, nil
+}
+
+// Container returns the container of the account as a storage backend.
+func (a *Account) Container(name string) *Container {
+	return &Container{client: a.client.ServiceClient().NewContainerClient(name), name: name}
+}
+
+// Container is a container of a storage account, the storage backend of the syncs whose backend is blob.
+// The objects are block blobs.
+type Container struct {
+	client *container.Client
+	name   string
+}
+
+var _ storage.Backend = (*Container)(nil)
+
+// Put uploads r into the blob of the key and returns the ETag of the blob.
+// Content larger than a block is staged in blocks read in parallel from the file, then the block list is committed.
+func (c *Container) Put(key string, r io.Reader, size int64, opts storage.UploadOptions) (string, error) {
+	ctx := context.Background()
+	client := c.client.NewBlockBlobClient(key)
+	blockSize := opts.PartSize
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	if minBlock := (size + maxBlocks - 1) / maxBlocks; blockSize < minBlock {
+		blockSize = minBlock
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		// The blocks are buffered, the content can not be read in parallel.
+		out, err := client.UploadStream(ctx, r, &blockblob.UploadStreamOptions{BlockSize: blockSize, Concurrency: concurrency})
+		if err != nil {
+			return "", err
+		}
+		return etag(out.ETag), nil
+	}
+	if size <= blockSize {
+		out, err := client.Upload(ctx, streaming.NopCloser(io.NewSectionReader(ra, 0, size)), nil)
+		if err != nil {
+			return "", err
+		}
+		return etag(out.ETag), nil
+	}
+
+	ids := make([]string, (size+blockSize-1)/blockSize)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+	for i := range ids {
+		// The ids of the blocks of a blob must have the same length.
+		ids[i] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("s3ync-%08d", i)))
+		off := int64(i) * blockSize
+		n := min(blockSize, size-off)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string, off, n int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, err := client.StageBlock(ctx, id, streaming.NopCloser(io.NewSectionReader(ra, off, n)), nil)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(ids[i], off, n)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		// The uncommitted blocks are discarded by the service after a week.
+		return "", firstErr
+	}
+	out, err := client.CommitBlockList(ctx, ids, nil)
+	if err != nil {
+		return "", err
+	}
+	return etag(out.ETag), nil
+}
+
+// Get returns the content of the blob of the key.
+func (c *Container) Get(key string) (io.ReadCloser, error) {
+	out, err := c.client.NewBlobClient(key).DownloadStream(context.Background(), nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Head returns the metadata of the blob of the key.
+func (c *Container) Head(key string) (*storage.ObjectInfo, error) {
+	out, err := c.client.NewBlobClient(key).GetProperties(context.Background(), nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &storage.ObjectInfo{
+		Size:         int64Value(out.ContentLength),
+		LastModified: timeValue(out.LastModified),
+		ETag:         etag(out.ETag),
+	}, nil
+}
+
+// List returns the metadata of every blob whose key starts with prefix. Key: object key
+func (c *Container) List(prefix string) (map[string]storage.ObjectInfo, error) {
+	objects := make(map[string]storage.ObjectInfo)
+	pager := c.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: to.Ptr(prefix)})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil || item.Properties == nil {
+				continue
+			}
+			objects[*item.Name] = storage.ObjectInfo{
+				Size:         int64Value(item.Properties.ContentLength),
+				LastModified: timeValue(item.Properties.LastModified),
+				ETag:         etag(item.Properties.ETag),
+			}
+		}
+	}
+	return objects, nil
+}
+
+// Delete deletes the blobs of the keys with their snapshots.
+func (c *Container) Delete(keys []string) error {
+	for _, key := range keys {
+		_, err := c.client.NewBlobClient(key).Delete(context.Background(), &blob.DeleteOptions{
+			DeleteSnapshots: to.Ptr(blob.DeleteSnapshotsOptionTypeInclude),
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy copies the blob of the key src to the key dst in the container. The copy runs in the service,
+// Copy waits for it to complete.
+func (c *Container) Copy(src, dst string, size int64) (string, error) {
+	ctx := context.Background()
+	client := c.client.NewBlobClient(dst)
+	// The url of the source blob has the SAS token of the client, if any.
+	out, err := client.StartCopyFromURL(ctx, c.client.NewBlobClient(src).URL(), nil)
+	if err != nil {
+		if isNotFound(err) {
+			return "", storage.ErrNotFound
+		}
+		return "", err
+	}
+	status := out.CopyStatus
+	var description *string
+	for status != nil && *status == blob.CopyStatusTypePending {
+		time.Sleep(copyPollInterval)
+		props, err := client.GetProperties(ctx, nil)
+		if err != nil {
+			return "", err
+		}
+		status, description = props.CopyStatus, props.CopyStatusDescription
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return "", &CopyFailedError{Src: src, Dst: dst, Status: string(*status), Description: stringValue(description)}
+	}
+	props, err := client.GetProperties(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	return etag(props.ETag), nil
+}
+
+// ETagIsMD5 reports false, the ETags of the blobs are opaque versions of the blobs.
+func (c *Container) ETagIsMD5() bool {
+	return false
+}
+
+// isNotFound reports whether the blob or its container does not exist.
+func isNotFound(err error) bool {
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return true
+	}
+	// The responses of HEAD requests have no body, only their status.
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+func etag(e *azcore.ETag) string {
+	if e == nil {
+		return ""
+	}
+	return string(*e)
+}
+
+func int64Value(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func timeValue(v *time.Time) time.Time {
+	if v == nil {
+		return time.Time{}
+	}
+	return *v
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
@@ -0,0 +1,25 @@
+package azure
+
+import "fmt"
+
+// BlobClientFailedError represents an error when trying to start a client of a storage account.
+type BlobClientFailedError struct {
+	Err error
+}
+
+// Allow BlobClientFailedError to satisfy error interface.
+func (e *BlobClientFailedError) Error() string {
+	return fmt.Sprintf("Failed to start a blob client: %q", e.Err)
+}
+
+// CopyFailedError represents an error when the service could not copy a blob.
+type CopyFailedError struct {
+	Src, Dst    string
+	Status      string
+	Description string
+}
+
+// Allow CopyFailedError to satisfy error interface.
+func (e *CopyFailedError) Error() string {
+	return fmt.Sprintf("Copying the blob %q to %q is %v: %v", e.Src, e.Dst, e.Status, e.Description)
+}
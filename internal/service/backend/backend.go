@@ -0,0 +1,109 @@
+// Package backend opens the storage backends the syncs select in the config file.
+package backend
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/azure"
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/crypt"
+	"github.com/akinbezatoglu/s3ync/internal/service/gcp"
+	"github.com/akinbezatoglu/s3ync/internal/service/localfs"
+	"github.com/akinbezatoglu/s3ync/internal/service/ops"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// Pool opens the backends of the syncs and keeps them for their next operations.
+// The clients of a service are created when the first sync of the service needs one.
+type Pool struct {
+	mu       sync.Mutex
+	s3       *ops.BucketBasics
+	blob     map[string]*azure.Account  // Key: blob profile
+	gcp      map[string]*gcp.Client     // Key: gcp profile
+	backends map[string]storage.Backend // Key: backend, profile, bucket, region and encryption of the syncs
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		blob:     make(map[string]*azure.Account),
+		gcp:      make(map[string]*gcp.Client),
+		backends: make(map[string]storage.Backend),
+	}
+}
+
+// Get returns the backend of the bucket of the sync.
+func (p *Pool) Get(s *config.Sync) (storage.Backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := s.Backend + "\x00" + s.Profile + "\x00" + s.Bucket + "\x00" + s.Region
+	if e := s.Encryption; e != nil {
+		// The syncs of a bucket may encrypt their objects differently.
+		key += fmt.Sprintf("\x00%v\x00%v\x00%v\x00%v", e.Type, e.KMSKeyID, e.BucketKey, e.KeyFile)
+	}
+	if e := s.ClientEncryption; e != nil {
+		key += "\x00" + e.KeyFile
+	}
+	if b, ok := p.backends[key]; ok {
+		return b, nil
+	}
+
+	var b storage.Backend
+	switch s.Backend {
+	case config.BackendS3, "":
+		if p.s3 == nil {
+			basics, err := ops.NewBucketBasics()
+			if err != nil {
+				return nil, &ops.S3ClientFailedError{Err: err}
+			}
+			p.s3 = basics
+		}
+		// The region of the bucket is detected if the sync does not record it.
+		bucket, err := p.s3.Bucket(s.Bucket, s.Profile, s.Region, s.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		b = bucket
+	case config.BackendLocal:
+		// The bucket of the sync is the directory it is mirrored into.
+		b = localfs.New(s.Bucket)
+	case config.BackendBlob:
+		account, ok := p.blob[s.Profile]
+		if !ok {
+			profile, err := config.GetBlobProfile(s.Profile)
+			if err != nil {
+				return nil, err
+			}
+			if account, err = azure.NewAccount(profile); err != nil {
+				return nil, err
+			}
+			p.blob[s.Profile] = account
+		}
+		b = account.Container(s.Bucket)
+	case config.BackendGCP:
+		client, ok := p.gcp[s.Profile]
+		if !ok {
+			profile, err := config.GetGCPProfile(s.Profile)
+			if err != nil {
+				return nil, err
+			}
+			if client, err = gcp.NewClient(profile); err != nil {
+				return nil, err
+			}
+			p.gcp[s.Profile] = client
+		}
+		b = client.Bucket(s.Bucket)
+	default:
+		return nil, &UnknownBackendError{Backend: s.Backend}
+	}
+	if e := s.ClientEncryption; e != nil {
+		// The content is encrypted before it is sent to the backend, and decrypted when it is read.
+		k, err := crypt.ReadKeyFile(e.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		b = crypt.NewBackend(b, k)
+	}
+	p.backends[key] = b
+	return b, nil
+}
@@ -0,0 +1,13 @@
+package backend
+
+import "fmt"
+
+// UnknownBackendError represents an error when a sync selects a backend that does not exist.
+type UnknownBackendError struct {
+	Backend string
+}
+
+// Allow UnknownBackendError to satisfy error interface.
+func (e *UnknownBackendError) Error() string {
+	return fmt.Sprintf("There is no storage backend %q", e.Backend)
+}
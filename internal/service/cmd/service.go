@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
 	"github.com/akinbezatoglu/s3ync/internal/service/watcher"
 )
 
@@ -10,9 +12,32 @@ func main() {
 	w, err := watcher.InitWatcher()
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(1)
 	}
 	defer w.Close()
 
+	// The s3ync cli talks to the service through the control socket.
+	srv, err := control.Listen(w)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer srv.Close()
+	go func() {
+		if err := srv.Serve(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
 	w.AddPathsAlreadyConfigured()
+	// Sync the changes made while the service was not running.
+	go w.ReconcileAll()
+	// The operations that failed, while the network was down for example, are tried again periodically.
+	go w.RetryFailed()
+	go func() {
+		if err := w.WatchConfig(); err != nil {
+			fmt.Println(err)
+		}
+	}()
 	w.Watch()
 }
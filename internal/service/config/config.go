@@ -3,10 +3,12 @@ package config
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,45 +20,295 @@ const (
 	xdgConfigHome  = "XDG_CONFIG_HOME"
 )
 
-var path = filepath.Join(ConfigDir(), "config.yml")
+var path = ConfigFile()
+
+// Delete policies of a sync, what happens in the bucket when a file is deleted locally.
+const (
+	DeleteMirror  = "mirror"  // the object is deleted as well
+	DeleteKeep    = "keep"    // the object is kept
+	DeleteArchive = "archive" // the object is moved to the trash prefix of the bucket
+)
+
+// DefaultTrashPrefix is the prefix of the objects archived by the archive delete policy.
+const DefaultTrashPrefix = ".s3ync-trash/"
+
+// Defaults of the syncs that do not set them.
+const (
+	DefaultDebounce      = 500 * time.Millisecond
+	DefaultStable        = time.Second
+	DefaultStableMaxWait = 10 * time.Minute
+)
+
+// Storage backends of the syncs.
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local" // the bucket is a directory, ex. a NAS mount or an external disk
+	BackendBlob  = "blob"  // Azure Blob Storage, the bucket is a container of the storage account of the profile
+	BackendGCP   = "gcp"   // Google Cloud Storage
+)
+
+// Server-side encryption of the objects of a sync, the default encryption of the bucket if a sync does not set one.
+const (
+	EncryptionSSES3  = "sse-s3"  // keys managed by S3
+	EncryptionSSEKMS = "sse-kms" // keys of AWS KMS, the default key of the account or the key of KMSKeyID
+	EncryptionSSEC   = "sse-c"   // the key of a local file, S3 never stores it
+)
+
+// backends are the storage backends a sync may select.
+var backends = map[string]bool{
+	BackendS3:    true,
+	BackendLocal: true,
+	BackendBlob:  true,
+	BackendGCP:   true,
+}
+
+// Sync is a local directory synced with a bucket.
+type Sync struct {
+	// Backend is the storage backend of the bucket, BackendS3 if the sync does not select one.
+	Backend string
+	Profile string // profile of the credentials of the bucket
+	Bucket  string
+	Region  string // region of the bucket
+	// Delete is the delete policy: DeleteMirror, DeleteKeep or DeleteArchive
+	Delete      string
+	TrashPrefix string
+	// PartSize is the size of the parts of multipart uploads in bytes, zero is the default of the uploader.
+	PartSize int64
+	// PartConcurrency is the number of parts of a file uploaded in parallel, zero is the default of the uploader.
+	PartConcurrency int
+	// Concurrency is the number of operations of the sync running at once, zero is the number of workers.
+	Concurrency int
+	// Debounce is the time a path must be quiet before its events are synced as one operation, zero syncs every event.
+	Debounce time.Duration
+	// Stable is the time the size and mtime of a file must not change before it is uploaded, zero uploads it at once.
+	Stable time.Duration
+	// StableMaxWait is the longest a changing file waits, it is uploaded and flagged after.
+	StableMaxWait time.Duration
+	// StableCheckOpen waits as well for the processes writing to the file to close it, where it is supported.
+	StableCheckOpen bool
+	// Include and Exclude are gitignore patterns relative to the root of the sync. When Include is set,
+	// only the files matching it are synced. Exclude adds to the .s3yncignore files of the directories.
+	Include []string
+	Exclude []string
+	// Encryption is the server-side encryption of the objects of the sync, nil for the default of the bucket.
+	Encryption *Encryption
+	// ClientEncryption encrypts the files before they are uploaded, nil uploads them as they are.
+	ClientEncryption *ClientEncryption
+}
+
+// Encryption is the server-side encryption of the objects of an s3 sync.
+type Encryption struct {
+	Type      string // EncryptionSSES3, EncryptionSSEKMS or EncryptionSSEC
+	KMSKeyID  string // id, alias or ARN of the KMS key, the default key of the account if it is empty
+	BucketKey bool   // encrypt the objects with a KMS key of the bucket, fewer requests are sent to KMS
+	KeyFile   string // file of the 256-bit SSE-C key, raw or base64 encoded
+}
+
+// NewEncryption checks the server-side encryption settings of a sync and returns them.
+func NewEncryption(typ, kmsKeyID string, bucketKey bool, keyFile string) (*Encryption, error) {
+	e := &Encryption{Type: strings.ToLower(typ), KMSKeyID: kmsKeyID, BucketKey: bucketKey, KeyFile: keyFile}
+	switch e.Type {
+	case EncryptionSSES3, EncryptionSSEKMS, EncryptionSSEC:
+	default:
+		return nil, fmt.Errorf("unknown encryption type '%s', use sse-s3, sse-kms or sse-c", typ)
+	}
+	if e.Type != EncryptionSSEKMS && (kmsKeyID != "" || bucketKey) {
+		return nil, fmt.Errorf("kms_key_id and bucket_key are settings of sse-kms only")
+	}
+	if e.Type == EncryptionSSEC && keyFile == "" {
+		return nil, fmt.Errorf("sse-c needs the key_file of its key")
+	}
+	if e.Type != EncryptionSSEC && keyFile != "" {
+		return nil, fmt.Errorf("key_file is a setting of sse-c only")
+	}
+	return e, nil
+}
+
+// ClientEncryption is the encryption of the content of the files of a sync before it is uploaded.
+// The bucket never sees the content, it can only be read back with the key.
+type ClientEncryption struct {
+	KeyFile string // file of the 256-bit AES-GCM key, raw or base64 encoded
+}
 
 type Syncs struct {
-	// Key: filesytem path, Value: [aws-profile, bucket-name]
-	All map[string][]string
+	// Key: filesytem path
+	All map[string]*Sync
+	// Key: profile of any backend, Value: the syncs of the profile are suspended by `s3ync stop --profile`
+	Paused map[string]bool
 }
 
-func GetAllSyncList() *Syncs {
-	data, _ := readFile(path)
+// GetAllSyncList reads the config file and returns every configured sync.
+func GetAllSyncList() (*Syncs, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
 
 	var syncs Syncs
-	syncs.All = make(map[string][]string)
+	syncs.All = make(map[string]*Sync)
+	syncs.Paused = make(map[string]bool)
 
 	// Create a map to hold the parsed YAML data
 	var yamlData map[string]interface{}
 	// Unmarshal the YAML text into the map
-	err := yaml.Unmarshal(data, &yamlData)
+	err = yaml.Unmarshal(data, &yamlData)
 	if err != nil {
-		log.Fatalf("Error unmarshalling YAML data: %v", err)
+		return nil, fmt.Errorf("error unmarshalling YAML data: %v", err)
 	}
 
-	m, err := extractNestedValue(yamlData, []string{"s3", "profiles"}...)
-	if err != nil {
-		fmt.Println(err)
-	}
-	for v := range m {
-		m, err := extractNestedValue(yamlData, []string{"s3", "profiles", v, "syncs"}...)
+	for _, section := range syncSections {
+		m, err := extractNestedValue(yamlData, section, "profiles")
 		if err != nil {
-			fmt.Println(err)
+			if section == BackendS3 {
+				return nil, err
+			}
+			// The config file has no profile of the backend.
+			continue
 		}
-		for vv := range m {
-			m, err := extractNestedValue(yamlData, []string{"s3", "profiles", v, "syncs", vv}...)
+		for v := range m {
+			profile, err := extractNestedValue(yamlData, section, "profiles", v)
 			if err != nil {
-				fmt.Println(err)
+				return nil, err
 			}
-			syncs.All[m["local"].(string)] = []string{v, m["bucket"].(string)}
+			if isTrue(profile["paused"]) {
+				syncs.Paused[v] = true
+			}
+			m, err := extractNestedValue(yamlData, section, "profiles", v, "syncs")
+			if err != nil {
+				if section == BackendS3 {
+					return nil, err
+				}
+				// The profile has no sync, only the settings of the backend.
+				continue
+			}
+			for vv := range m {
+				m, err := extractNestedValue(yamlData, section, "profiles", v, "syncs", vv)
+				if err != nil {
+					return nil, err
+				}
+				local, s, err := parseSync(v, vv, m, section)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := syncs.All[local]; ok {
+					return nil, fmt.Errorf("sync '%s' of the profile '%s': %s is synced more than once", vv, v, local)
+				}
+				syncs.All[local] = s
+			}
+		}
+	}
+	return &syncs, nil
+}
+
+// syncSections are the sections of the config file whose profiles have syncs. A section is named after
+// the backend of its syncs. The syncs of the s3 section select their backend, the local backend's are there as well.
+var syncSections = []string{BackendS3, BackendBlob, BackendGCP}
+
+// parseSync parses the sync of the profile listed in the section of sectionBackend and returns its local path.
+func parseSync(profile, id string, m map[string]interface{}, sectionBackend string) (string, *Sync, error) {
+	bucket, err := extractNestedValue(m, "bucket")
+	if err != nil {
+		return "", nil, err
+	}
+	local, _ := m["local"].(string)
+	name, _ := bucket["name"].(string)
+	if local == "" || name == "" {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s' has no local path or bucket name", id, profile)
+	}
+	region, _ := bucket["region"].(string)
+	backend, _ := m["backend"].(string)
+	if backend == "" {
+		backend = sectionBackend
+	}
+	if !backends[backend] {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': unknown backend '%s'", id, profile, backend)
+	}
+	if sectionBackend != BackendS3 && backend != sectionBackend {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': the syncs of %s.profiles are %s syncs", id, profile, sectionBackend, sectionBackend)
+	}
+	if backend == BackendLocal {
+		if err := checkLocalTarget(local, name); err != nil {
+			return "", nil, fmt.Errorf("sync '%s' of the profile '%s': %v", id, profile, err)
+		}
+	}
+	policy, err := deletePolicy(m)
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': %v", id, profile, err)
+	}
+	partSize, err := intValue(m["part_size"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': part_size: %v", id, profile, err)
+	}
+	partConcurrency, err := intValue(m["part_concurrency"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': part_concurrency: %v", id, profile, err)
+	}
+	concurrency, err := intValue(m["concurrency"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': concurrency: %v", id, profile, err)
+	}
+	debounce := DefaultDebounce
+	if d, ok := m["debounce"]; ok {
+		if debounce, err = durationValue(d); err != nil {
+			return "", nil, fmt.Errorf("sync '%s' of the profile '%s': debounce: %v", id, profile, err)
 		}
 	}
-	return &syncs
+	stable := DefaultStable
+	if d, ok := m["stable"]; ok {
+		if stable, err = durationValue(d); err != nil {
+			return "", nil, fmt.Errorf("sync '%s' of the profile '%s': stable: %v", id, profile, err)
+		}
+	}
+	stableMaxWait, err := durationValue(m["stable_max_wait"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': stable_max_wait: %v", id, profile, err)
+	}
+	if stableMaxWait == 0 {
+		stableMaxWait = DefaultStableMaxWait
+	}
+	include, err := stringList(m["include"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': include: %v", id, profile, err)
+	}
+	exclude, err := stringList(m["exclude"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': exclude: %v", id, profile, err)
+	}
+	encryption, err := encryptionValue(m["encryption"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': encryption: %v", id, profile, err)
+	}
+	if encryption != nil && backend != BackendS3 {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': encryption is a setting of the s3 backend only", id, profile)
+	}
+	clientEncryption, err := clientEncryptionValue(m["client_encryption"])
+	if err != nil {
+		return "", nil, fmt.Errorf("sync '%s' of the profile '%s': client_encryption: %v", id, profile, err)
+	}
+	trashPrefix, _ := m["trash_prefix"].(string)
+	if trashPrefix == "" {
+		trashPrefix = DefaultTrashPrefix
+	}
+	return local, &Sync{
+		Backend:     backend,
+		Profile:     profile,
+		Bucket:      name,
+		Region:      region,
+		Delete:      policy,
+		TrashPrefix: strings.TrimSuffix(trashPrefix, "/") + "/",
+		// part_size is in MiB
+		PartSize:         int64(partSize) << 20,
+		PartConcurrency:  partConcurrency,
+		Concurrency:      concurrency,
+		Debounce:         debounce,
+		Stable:           stable,
+		StableMaxWait:    stableMaxWait,
+		StableCheckOpen:  isTrue(m["stable_check_open"]),
+		Include:          include,
+		Exclude:          exclude,
+		Encryption:       encryption,
+		ClientEncryption: clientEncryption,
+	}, nil
 }
 
 func extractNestedValue(data map[string]interface{}, keys ...string) (map[string]interface{}, error) {
@@ -68,13 +320,345 @@ func extractNestedValue(data map[string]interface{}, keys ...string) (map[string
 			return nil, fmt.Errorf("key '%s' not found", key)
 		}
 
-		nextMap := value.(map[string]interface{})
+		// An empty entry (ex. `syncs:`) is unmarshalled as nil.
+		nextMap, _ := value.(map[string]interface{})
 		currentMap = nextMap
 	}
 
 	return currentMap, nil
 }
 
+// S3Profile is the settings of an aws profile in the `s3.profiles` section of the config file.
+type S3Profile struct {
+	// Endpoint is the url of an S3 compatible server, ex. MinIO, Ceph, Wasabi or LocalStack.
+	// The endpoint of aws for the region of the profile if it is not set.
+	Endpoint string
+	// PathStyle puts the bucket in the path of the urls instead of their host, most S3 compatible servers need it.
+	PathStyle bool
+	// InsecureTLS does not verify the certificate of the endpoint.
+	InsecureTLS bool
+	// CABundle is a PEM file of the certificate authorities the certificate of the endpoint is verified with,
+	// instead of the ones of the system.
+	CABundle string
+}
+
+// GetS3Profiles reads the settings of the aws profiles from the config file. Key: aws profile
+func GetS3Profiles() (map[string]*S3Profile, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML data: %v", err)
+	}
+	profiles := make(map[string]*S3Profile)
+	m, err := extractNestedValue(yamlData, "s3", "profiles")
+	if err != nil {
+		return profiles, nil
+	}
+	for name, v := range m {
+		settings, _ := v.(map[string]interface{})
+		p := &S3Profile{
+			PathStyle:   isTrue(settings["path_style"]),
+			InsecureTLS: isTrue(settings["insecure_tls"]),
+		}
+		p.Endpoint, _ = settings["endpoint"].(string)
+		p.CABundle, _ = settings["ca_bundle"].(string)
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// BlobProfile is a storage account of Azure Blob Storage in the `blob.profiles` section of the config file.
+// The account is authorized by its connection string, a SAS token or its shared key, in this order.
+type BlobProfile struct {
+	ConnectionString string
+	Account          string
+	AccountKey       string // shared key of the account
+	SASToken         string
+	// Endpoint is the url of the blob service of the account, https://<account>.blob.core.windows.net/ if it is not set.
+	// ex. http://127.0.0.1:10000/devstoreaccount1/ for the Azurite emulator
+	Endpoint string
+}
+
+// GetBlobProfile reads the storage account of the profile from the config file.
+func GetBlobProfile(profile string) (*BlobProfile, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML data: %v", err)
+	}
+	m, err := extractNestedValue(yamlData, "blob", "profiles", profile)
+	if err != nil {
+		return nil, fmt.Errorf("blob profile '%s' is not in the config file", profile)
+	}
+	p := &BlobProfile{}
+	p.ConnectionString, _ = m["connection_string"].(string)
+	p.Account, _ = m["account"].(string)
+	p.AccountKey, _ = m["account_key"].(string)
+	p.SASToken, _ = m["sas_token"].(string)
+	p.Endpoint, _ = m["endpoint"].(string)
+	if p.ConnectionString == "" && (p.Account == "" && p.Endpoint == "" || p.AccountKey == "" && p.SASToken == "") {
+		return nil, fmt.Errorf("blob profile '%s' has no connection_string, or account with account_key or sas_token", profile)
+	}
+	if p.AccountKey != "" && p.Account == "" {
+		return nil, fmt.Errorf("blob profile '%s': account_key needs the account", profile)
+	}
+	return p, nil
+}
+
+// GCPProfile is the credentials of Google Cloud Storage in the `gcp.profiles` section of the config file.
+type GCPProfile struct {
+	// CredentialsFile is the service account JSON file, the application default credentials if it is not set.
+	CredentialsFile string
+	// Endpoint is the url of the JSON API, https://storage.googleapis.com/storage/v1/ if it is not set.
+	// ex. http://127.0.0.1:4443/storage/v1/ for fake-gcs-server, the requests are not authorized
+	// when there is no credentials file.
+	Endpoint string
+}
+
+// GetGCPProfile reads the credentials of the profile from the config file.
+func GetGCPProfile(profile string) (*GCPProfile, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML data: %v", err)
+	}
+	m, err := extractNestedValue(yamlData, "gcp", "profiles", profile)
+	if err != nil {
+		return nil, fmt.Errorf("gcp profile '%s' is not in the config file", profile)
+	}
+	p := &GCPProfile{}
+	p.CredentialsFile, _ = m["credentials_file"].(string)
+	p.Endpoint, _ = m["endpoint"].(string)
+	return p, nil
+}
+
+// Defaults of the service options.
+const (
+	DefaultWorkers       = 8
+	DefaultQueueSize     = 1000
+	DefaultRetryAttempts = 5
+	DefaultRetryInterval = 5 * time.Minute
+)
+
+// ServiceOptions are the options of the service in the `service` section of the config file.
+type ServiceOptions struct {
+	// Workers is the number of operations sent to the buckets at once.
+	Workers int
+	// QueueSize is the number of operations waiting for a worker. When the queue is full,
+	// the events are not read until a worker is free.
+	QueueSize int
+	// RetryAttempts is the number of attempts of an operation that fails with a transient error
+	// before it is moved to the retry queue.
+	RetryAttempts int
+	// RetryInterval is the interval between the automatic retries of the retry queue, zero disables them.
+	RetryInterval time.Duration
+}
+
+// GetServiceOptions reads the service options from the config file.
+func GetServiceOptions() (*ServiceOptions, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML data: %v", err)
+	}
+
+	opts := &ServiceOptions{
+		Workers:       DefaultWorkers,
+		QueueSize:     DefaultQueueSize,
+		RetryAttempts: DefaultRetryAttempts,
+		RetryInterval: DefaultRetryInterval,
+	}
+	m, err := extractNestedValue(yamlData, "service")
+	if err != nil {
+		// There is no service section.
+		return opts, nil
+	}
+	if n, err := intValue(m["workers"]); err != nil {
+		return nil, fmt.Errorf("service: workers: %v", err)
+	} else if n > 0 {
+		opts.Workers = n
+	}
+	if n, err := intValue(m["queue_size"]); err != nil {
+		return nil, fmt.Errorf("service: queue_size: %v", err)
+	} else if n > 0 {
+		opts.QueueSize = n
+	}
+	if n, err := intValue(m["retry_attempts"]); err != nil {
+		return nil, fmt.Errorf("service: retry_attempts: %v", err)
+	} else if n > 0 {
+		opts.RetryAttempts = n
+	}
+	if v, ok := m["retry_interval"]; ok {
+		d, err := durationValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("service: retry_interval: %v", err)
+		}
+		opts.RetryInterval = d
+	}
+	return opts, nil
+}
+
+// deletePolicy returns the delete policy of a sync.
+// Syncs added before the policies existed have `recursive` instead: true is mirror, false is keep.
+func deletePolicy(sync map[string]interface{}) (string, error) {
+	policy, _ := sync["delete"].(string)
+	switch policy {
+	case DeleteMirror, DeleteKeep, DeleteArchive:
+		return policy, nil
+	case "":
+		if isTrue(sync["recursive"]) {
+			return DeleteMirror, nil
+		}
+		return DeleteKeep, nil
+	}
+	return "", fmt.Errorf("unknown delete policy '%s'", policy)
+}
+
+// encryptionValue returns the encryption block of a sync, nil if it has none.
+func encryptionValue(v interface{}) (*Encryption, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'%v' is not a map", v)
+	}
+	typ, _ := m["type"].(string)
+	kmsKeyID, _ := m["kms_key_id"].(string)
+	keyFile, _ := m["key_file"].(string)
+	return NewEncryption(typ, kmsKeyID, isTrue(m["bucket_key"]), keyFile)
+}
+
+// clientEncryptionValue returns the client_encryption block of a sync, nil if it has none.
+func clientEncryptionValue(v interface{}) (*ClientEncryption, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'%v' is not a map", v)
+	}
+	keyFile, _ := m["key_file"].(string)
+	if keyFile == "" {
+		return nil, fmt.Errorf("key_file is missing")
+	}
+	if !filepath.IsAbs(filepath.FromSlash(keyFile)) {
+		return nil, fmt.Errorf("the key_file '%s' is not an absolute path", keyFile)
+	}
+	return &ClientEncryption{KeyFile: keyFile}, nil
+}
+
+// checkLocalTarget checks the directory a sync is mirrored into by the local backend.
+// The directories must not overlap, the files written into the target would be synced again.
+func checkLocalTarget(local, target string) error {
+	if !filepath.IsAbs(filepath.FromSlash(target)) {
+		return fmt.Errorf("the directory '%s' of the local backend is not an absolute path", target)
+	}
+	local = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(local)), "/")
+	target = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(target)), "/")
+	if local == target || strings.HasPrefix(target, local+"/") || strings.HasPrefix(local, target+"/") {
+		return fmt.Errorf("the directory '%s' of the local backend overlaps with '%s'", target, local)
+	}
+	return nil
+}
+
+// intValue returns a non-negative yaml integer, the s3ync cli writes integers as strings. A missing value is zero.
+func intValue(v interface{}) (int, error) {
+	var n int
+	switch i := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		n = i
+	case string:
+		var err error
+		if n, err = strconv.Atoi(i); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("'%v' is not an integer", v)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("'%v' is negative", v)
+	}
+	return n, nil
+}
+
+// durationValue parses a duration such as 30s or 5m, a number is a number of seconds.
+func durationValue(v interface{}) (time.Duration, error) {
+	switch d := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		if d < 0 {
+			return 0, fmt.Errorf("'%v' is negative", v)
+		}
+		return time.Duration(d) * time.Second, nil
+	case string:
+		if n, err := strconv.Atoi(d); err == nil {
+			return durationValue(n)
+		}
+		t, err := time.ParseDuration(d)
+		if err != nil {
+			return 0, err
+		}
+		if t < 0 {
+			return 0, fmt.Errorf("'%v' is negative", v)
+		}
+		return t, nil
+	}
+	return 0, fmt.Errorf("'%v' is not a duration", v)
+}
+
+// stringList reads a list of strings, or a comma separated string as the s3ync cli writes it.
+func stringList(v interface{}) ([]string, error) {
+	var list []string
+	switch l := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		for _, s := range strings.Split(l, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	case []interface{}:
+		for _, e := range l {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%v' is not a string", e)
+			}
+			list = append(list, s)
+		}
+	default:
+		return nil, fmt.Errorf("'%v' is not a list", v)
+	}
+	return list, nil
+}
+
+// isTrue reports whether a yaml value is true, the s3ync cli writes booleans as strings.
+func isTrue(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	}
+	return false
+}
+
 func readFile(filename string) ([]byte, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -103,3 +687,8 @@ func ConfigDir() string {
 	}
 	return path
 }
+
+// ConfigFile returns the path of the config file shared with the s3ync cli.
+func ConfigFile() string {
+	return filepath.Join(ConfigDir(), "config.yml")
+}
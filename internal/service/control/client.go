@@ -0,0 +1,133 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	dialTimeout  = 2 * time.Second        // limits the time spent connecting to the service
+	pollInterval = 200 * time.Millisecond // interval between the checks of WaitRunning and WaitStopped
+)
+
+// Client sends commands to the s3ync service.
+type Client struct {
+	socket string
+}
+
+// NewClient returns a Client of the service listening on SocketFile.
+func NewClient() *Client {
+	return &Client{socket: SocketFile()}
+}
+
+// AddSync tells the service to watch the sync whose root is local and upload its contents.
+func (c *Client) AddSync(local string) error {
+	_, err := c.do(&Request{Command: CommandAdd, Local: local})
+	return err
+}
+
+// RemoveSync tells the service to stop watching the sync whose root is local.
+func (c *Client) RemoveSync(local string) error {
+	_, err := c.do(&Request{Command: CommandRemove, Local: local})
+	return err
+}
+
+// Status returns the state of the service.
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.do(&Request{Command: CommandStatus})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// Pause suspends the syncs of the profile, or of all profiles if profile is empty.
+func (c *Client) Pause(profile string) error {
+	_, err := c.do(&Request{Command: CommandPause, Profile: profile})
+	return err
+}
+
+// Resume restarts the suspended syncs of the profile, or of all profiles if profile is empty.
+func (c *Client) Resume(profile string) error {
+	_, err := c.do(&Request{Command: CommandResume, Profile: profile})
+	return err
+}
+
+// Retry tells the service to queue again the failed operations and returns their number.
+func (c *Client) Retry() (int, error) {
+	resp, err := c.do(&Request{Command: CommandRetry})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Retried, nil
+}
+
+// SyncedKeys returns the keys of the objects uploaded by the sync whose root is local.
+func (c *Client) SyncedKeys(local string) ([]string, error) {
+	resp, err := c.do(&Request{Command: CommandSynced, Local: local})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Stop tells the service to stop gracefully.
+func (c *Client) Stop() error {
+	_, err := c.do(&Request{Command: CommandStop})
+	return err
+}
+
+// IsRunning reports whether the service answers on its socket.
+func (c *Client) IsRunning() bool {
+	_, err := c.Status()
+	var notRunning *ServiceNotRunningError
+	return !errors.As(err, &notRunning)
+}
+
+// WaitStopped waits until the service stops answering on its socket.
+func (c *Client) WaitStopped(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for c.IsRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("s3ync service did not stop in %v", timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+// WaitRunning waits until the service answers on its socket.
+func (c *Client) WaitRunning(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !c.IsRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("s3ync service did not start in %v, see %s", timeout, LogFile())
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+func (c *Client) do(req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.socket, dialTimeout)
+	if err != nil {
+		return nil, &ServiceNotRunningError{Err: err}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, &CommandFailedError{Command: req.Command, Err: resp.Error}
+	}
+	return &resp, nil
+}
@@ -0,0 +1,123 @@
+// Package control is the local control endpoint of the s3ync service.
+// The service listens on a unix domain socket in the config directory and
+// the s3ync cli sends one JSON request per connection and reads one JSON response.
+package control
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+)
+
+// Commands accepted by the service.
+const (
+	CommandAdd    = "add"
+	CommandRemove = "remove"
+	CommandStatus = "status"
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandStop   = "stop"
+	CommandRetry  = "retry"
+	CommandSynced = "synced"
+)
+
+// Request is a command sent by the s3ync cli to the service.
+type Request struct {
+	Command string `json:"command"`
+	// Profile is the aws profile of the syncs to pause or resume. Empty means all profiles.
+	Profile string `json:"profile,omitempty"`
+	// Local is the root path of the sync to add, remove or list, as written in the config file.
+	Local string `json:"local,omitempty"`
+}
+
+// Response is the answer of the service to a Request.
+type Response struct {
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"`
+	// Retried is the number of failed operations queued again by the retry command.
+	Retried int `json:"retried,omitempty"`
+	// Keys are the keys of the objects uploaded by the sync, the answer of the synced command.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Status is the state of the service.
+type Status struct {
+	StartedAt    time.Time     `json:"started_at"`
+	Workers      int           `json:"workers"`
+	QueueDepth   int           `json:"queue_depth"` // operations waiting for a worker
+	Syncs        []SyncStatus  `json:"syncs"`
+	RecentErrors []ErrorStatus `json:"recent_errors"`
+}
+
+// SyncStatus is the state of a configured sync.
+type SyncStatus struct {
+	Local           string     `json:"local"`
+	Profile         string     `json:"profile"`
+	Bucket          string     `json:"bucket"`
+	Paused          bool       `json:"paused"`
+	Delete          string     `json:"delete,omitempty"` // delete policy of the sync
+	Watches         int        `json:"watches"`
+	QueuedUploads   int        `json:"queued_uploads"`
+	InflightUploads int        `json:"inflight_uploads"`
+	QueuedDeletes   int        `json:"queued_deletes"`
+	InflightDeletes int        `json:"inflight_deletes"`
+	Failed          int        `json:"failed"` // operations waiting in the retry queue
+	LastSync        *time.Time `json:"last_sync,omitempty"`
+	// Uploads is the progress of the in-flight uploads.
+	Uploads []UploadProgress `json:"uploads,omitempty"`
+	// Reconciled is the result of the last comparison of the sync with its bucket.
+	Reconciled *ReconcileSummary `json:"reconciled,omitempty"`
+	// Unstable are the last files uploaded while they were still changing after the maximum wait.
+	Unstable []string `json:"unstable,omitempty"`
+}
+
+// UploadProgress is the progress of an in-flight upload.
+type UploadProgress struct {
+	Path  string `json:"path"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+}
+
+// ReconcileSummary is the work queued by the comparison of a sync with its bucket.
+type ReconcileSummary struct {
+	Time      time.Time `json:"time"`
+	Uploads   int       `json:"uploads"`
+	Deletes   int       `json:"deletes"`
+	Unchanged int       `json:"unchanged"`
+}
+
+// ErrorStatus is a failed operation of a sync.
+type ErrorStatus struct {
+	Time  time.Time `json:"time"`
+	Local string    `json:"local"`
+	Path  string    `json:"path"`
+	Error string    `json:"error"`
+}
+
+// Handler executes the commands received by the Server.
+type Handler interface {
+	// AddSync starts watching the sync whose root is local after it is added to the config file.
+	AddSync(local string) error
+	// RemoveSync stops watching the sync whose root is local after it is removed from the config file.
+	RemoveSync(local string) error
+	Status() *Status
+	Pause(profile string) error
+	Resume(profile string) error
+	// Retry queues again the failed operations of the retry queue and returns their number.
+	Retry() (int, error)
+	// SyncedKeys returns the keys of the objects uploaded by the sync whose root is local.
+	SyncedKeys(local string) ([]string, error)
+	Stop()
+}
+
+// SocketFile returns the path of the unix domain socket of the service.
+func SocketFile() string {
+	return filepath.Join(config.ConfigDir(), "s3ync.sock")
+}
+
+// LogFile returns the path of the output of the service started by the s3ync cli.
+func LogFile() string {
+	return filepath.Join(config.ConfigDir(), "s3ync.log")
+}
@@ -0,0 +1,29 @@
+package control
+
+import "fmt"
+
+// ServiceNotRunningError represents an error when the s3ync service can not be reached.
+type ServiceNotRunningError struct {
+	Err error
+}
+
+// Allow ServiceNotRunningError to satisfy error interface.
+func (e *ServiceNotRunningError) Error() string {
+	return fmt.Sprintf("s3ync service is not running: %q", e.Err)
+}
+
+// Allow ServiceNotRunningError to be unwrapped.
+func (e *ServiceNotRunningError) Unwrap() error {
+	return e.Err
+}
+
+// CommandFailedError represents an error returned by the service while executing a command.
+type CommandFailedError struct {
+	Command string
+	Err     string
+}
+
+// Allow CommandFailedError to satisfy error interface.
+func (e *CommandFailedError) Error() string {
+	return fmt.Sprintf("s3ync service failed to %s: %s", e.Command, e.Err)
+}
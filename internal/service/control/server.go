@@ -0,0 +1,109 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// requestTimeout limits the time spent reading a request and writing its response.
+const requestTimeout = time.Minute
+
+// Server accepts the requests of the s3ync cli and passes them to a Handler.
+type Server struct {
+	listener net.Listener
+	handler  Handler
+}
+
+// Listen creates the socket of the service. A socket left by a previous service that
+// was not stopped gracefully is removed first.
+func Listen(h Handler) (*Server, error) {
+	if c, err := net.Dial("unix", SocketFile()); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("another s3ync service is already listening on %s", SocketFile())
+	}
+	if err := os.Remove(SocketFile()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", SocketFile())
+	if err != nil {
+		return nil, err
+	}
+	return &Server{listener: l, handler: h}, nil
+}
+
+// Serve accepts connections until the server is closed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and removes the socket.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(&Response{Error: err.Error()})
+		return
+	}
+	resp, after := s.handle(&req)
+	json.NewEncoder(conn).Encode(resp)
+	if after != nil {
+		after()
+	}
+}
+
+// handle executes the request. The returned function, if any, runs after the response is sent.
+func (s *Server) handle(req *Request) (*Response, func()) {
+	var err error
+	switch req.Command {
+	case CommandAdd:
+		err = s.handler.AddSync(req.Local)
+	case CommandRemove:
+		err = s.handler.RemoveSync(req.Local)
+	case CommandStatus:
+		return &Response{OK: true, Status: s.handler.Status()}, nil
+	case CommandPause:
+		err = s.handler.Pause(req.Profile)
+	case CommandResume:
+		err = s.handler.Resume(req.Profile)
+	case CommandRetry:
+		n, err := s.handler.Retry()
+		if err != nil {
+			return &Response{Error: err.Error()}, nil
+		}
+		return &Response{OK: true, Retried: n}, nil
+	case CommandSynced:
+		keys, err := s.handler.SyncedKeys(req.Local)
+		if err != nil {
+			return &Response{Error: err.Error()}, nil
+		}
+		return &Response{OK: true, Keys: keys}, nil
+	case CommandStop:
+		// The service exits after it stops, the response must be sent before.
+		return &Response{OK: true}, s.handler.Stop
+	default:
+		err = fmt.Errorf("unknown command %q", req.Command)
+	}
+	if err != nil {
+		return &Response{Error: err.Error()}, nil
+	}
+	return &Response{OK: true}, nil
+}
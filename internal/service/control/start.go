@@ -0,0 +1,48 @@
+package control
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// serviceCommandEnv overrides the command that starts the service,
+	// ex. `docker start s3ync` when the service runs in a container.
+	serviceCommandEnv     = "S3YNC_SERVICE_COMMAND"
+	defaultServiceCommand = "s3ync-service"
+)
+
+// StartService starts the service in the background. Its output is appended to LogFile.
+// It does not wait for the service to listen on its socket, see Client.WaitRunning.
+func StartService() error {
+	command := os.Getenv(serviceCommandEnv)
+	if command == "" {
+		command = defaultServiceCommand
+	}
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("%s is empty", serviceCommandEnv)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(LogFile()), 0771); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(LogFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	// The service must keep running after the s3ync cli exits.
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the s3ync service with %q: %w", command, err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package control
+
+import "syscall"
+
+// detachedProcAttr starts the service in a new session, so it does not receive the signals of the terminal.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
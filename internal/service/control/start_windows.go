@@ -0,0 +1,11 @@
+//go:build windows
+
+package control
+
+import "syscall"
+
+// detachedProcAttr starts the service in a new process group without a console window.
+func detachedProcAttr() *syscall.SysProcAttr {
+	const detachedProcess = 0x00000008
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
@@ -0,0 +1,82 @@
+package crypt
+
+import (
+	"io"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// Backend encrypts the content of the objects of a backend on the client. The sizes of the objects
+// are the sizes of their content, the ETags are the ETags of the encrypted objects.
+type Backend struct {
+	backend storage.Backend
+	key     []byte
+}
+
+var _ storage.Backend = (*Backend)(nil)
+
+// NewBackend returns the backend b whose objects are encrypted with the key.
+func NewBackend(b storage.Backend, key []byte) *Backend {
+	return &Backend{backend: b, key: key}
+}
+
+// Put encrypts the content of r while it is streamed into the object of the key.
+func (b *Backend) Put(key string, r io.Reader, size int64, opts storage.UploadOptions) (string, error) {
+	encrypted, err := NewReader(b.key, r)
+	if err != nil {
+		return "", err
+	}
+	return b.backend.Put(key, encrypted, EncryptedSize(size), opts)
+}
+
+// Get returns the decrypted content of the object of the key.
+func (b *Backend) Get(key string) (io.ReadCloser, error) {
+	rc, err := b.backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewDecryptReader(b.key, rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
+
+func (b *Backend) Head(key string) (*storage.ObjectInfo, error) {
+	info, err := b.backend.Head(key)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = DecryptedSize(info.Size)
+	return info, nil
+}
+
+func (b *Backend) List(prefix string) (map[string]storage.ObjectInfo, error) {
+	objects, err := b.backend.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for key, info := range objects {
+		info.Size = DecryptedSize(info.Size)
+		objects[key] = info
+	}
+	return objects, nil
+}
+
+func (b *Backend) Delete(keys []string) error {
+	return b.backend.Delete(keys)
+}
+
+// Copy copies the encrypted object, its key is derived from its salt so the copy decrypts with the same key.
+func (b *Backend) Copy(src, dst string, size int64) (string, error) {
+	return b.backend.Copy(src, dst, EncryptedSize(size))
+}
+
+// ETagIsMD5 reports false, the ETags are the ETags of the encrypted objects.
+func (b *Backend) ETagIsMD5() bool {
+	return false
+}
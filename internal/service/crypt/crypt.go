@@ -0,0 +1,259 @@
+// Package crypt encrypts the content of the files on the client before it is uploaded, with AES-256-GCM.
+//
+// The content is encrypted in chunks so files of any size are streamed. An encrypted object is
+// a header followed by the chunks:
+//
+//	magic "S3YE" | version (1 byte) | chunk size (4 bytes, big endian) | salt (32 bytes)
+//	chunk 0 | chunk 1 | ... | last chunk
+//
+// The chunks are sealed with a key derived from the key of the sync and the random salt of the object,
+// the nonce of a chunk is its index and a flag set on the last chunk. Every chunk is full but the last,
+// which is shorter and may be empty, so a truncated or extended object fails to decrypt.
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// KeySize is the size of the keys of the syncs, the content is encrypted with AES-256.
+	KeySize = 32
+	// ChunkSize is the size of the plaintext of the chunks.
+	ChunkSize = 64 << 10
+
+	magic      = "S3YE"
+	version    = 1
+	saltSize   = 32
+	headerSize = len(magic) + 1 + 4 + saltSize
+	tagSize    = 16
+	// maxChunkSize is the largest chunk size accepted in the header of an object.
+	maxChunkSize = 16 << 20
+)
+
+// ReadKeyFile returns the 256-bit key of the file, the file holds the key itself or its base64 encoding.
+func ReadKeyFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, &InvalidKeyFileError{File: name, Err: err}
+	}
+	if len(data) == KeySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != KeySize {
+		return nil, &InvalidKeyFileError{File: name}
+	}
+	return key, nil
+}
+
+// EncryptedSize returns the size of the encrypted content of size bytes.
+func EncryptedSize(size int64) int64 {
+	chunks := size/ChunkSize + 1
+	return int64(headerSize) + size + chunks*tagSize
+}
+
+// DecryptedSize returns the size of the content of an object of size bytes encrypted with ChunkSize,
+// the inverse of EncryptedSize. It returns zero for a size no content is encrypted to.
+func DecryptedSize(size int64) int64 {
+	size -= int64(headerSize)
+	full := size / (ChunkSize + tagSize)
+	last := size%(ChunkSize+tagSize) - tagSize
+	if size < tagSize || last < 0 {
+		return 0
+	}
+	return full*ChunkSize + last
+}
+
+// aead returns the cipher of the object whose salt is salt.
+func aead(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("s3ync object key"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of the chunk of the index.
+func nonce(index uint64, last bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[3:11], index)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+type encryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	index  uint64
+	chunk  []byte
+	buf    []byte // sealed bytes not read yet
+	done   bool
+}
+
+// NewReader returns a reader of the content of r encrypted with the key.
+func NewReader(key []byte, r io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	a, err := aead(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, version)
+	header = binary.BigEndian.AppendUint32(header, ChunkSize)
+	header = append(header, salt...)
+	return &encryptReader{
+		r:      bufio.NewReaderSize(r, ChunkSize),
+		aead:   a,
+		header: header,
+		chunk:  make([]byte, ChunkSize),
+		buf:    header,
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+// seal encrypts the next chunk of the content. A full chunk is the last one if nothing follows it.
+func (e *encryptReader) seal() error {
+	n, err := io.ReadFull(e.r, e.chunk)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := e.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if last && n == ChunkSize {
+		// The last chunk must be shorter than the others, an empty one follows.
+		e.buf = e.aead.Seal(e.buf[:0], nonce(e.index, false), e.chunk[:n], e.header)
+		e.index++
+		e.buf = e.aead.Seal(e.buf, nonce(e.index, true), nil, e.header)
+	} else {
+		e.buf = e.aead.Seal(e.buf[:0], nonce(e.index, last), e.chunk[:n], e.header)
+	}
+	e.index++
+	e.done = last
+	return nil
+}
+
+type decryptReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	header    []byte
+	index     uint64
+	chunkSize int
+	sealed    []byte
+	buf       []byte // opened bytes not read yet
+	done      bool
+}
+
+// NewDecryptReader returns a reader of the content of r, encrypted by NewReader with the key.
+func NewDecryptReader(key []byte, r io.Reader) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidObject
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrInvalidObject
+	}
+	if header[len(magic)] != version {
+		return nil, &UnknownVersionError{Version: int(header[len(magic)])}
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[len(magic)+1:]))
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		return nil, ErrInvalidObject
+	}
+	a, err := aead(key, header[len(magic)+5:])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:         r,
+		aead:      a,
+		header:    header,
+		chunkSize: chunkSize,
+		sealed:    make([]byte, chunkSize+tagSize),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk of the object. The chunk shorter than the others is the last one.
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	last := false
+	switch {
+	case err == io.EOF:
+		// The last chunk is missing.
+		return ErrInvalidObject
+	case err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	}
+	plain, err := d.aead.Open(d.sealed[:0], nonce(d.index, last), d.sealed[:n], d.header)
+	if err != nil {
+		return ErrInvalidObject
+	}
+	d.buf = plain
+	d.index++
+	d.done = last
+	return nil
+}
+
+// ErrInvalidObject is returned when an object is not encrypted by s3ync with the key,
+// or it is changed or truncated after it is uploaded.
+var ErrInvalidObject = errors.New("the object is not encrypted with the key of the sync, or it is damaged")
@@ -0,0 +1,150 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encrypt(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	r, err := NewReader(key, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func decrypt(key, sealed []byte) ([]byte, error) {
+	r, err := NewDecryptReader(key, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"short", 1},
+		{"under a chunk", ChunkSize - 1},
+		{"a chunk", ChunkSize},
+		{"two chunks", 2 * ChunkSize},
+		{"multi chunk", 2*ChunkSize + 123},
+	}
+	key := newKey(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := make([]byte, tt.size)
+			rand.Read(plain)
+			sealed := encrypt(t, key, plain)
+			if got, want := int64(len(sealed)), EncryptedSize(int64(tt.size)); got != want {
+				t.Errorf("encrypted to %d bytes, EncryptedSize returns %d", got, want)
+			}
+			if got := DecryptedSize(int64(len(sealed))); got != int64(tt.size) {
+				t.Errorf("DecryptedSize returns %d, want %d", got, tt.size)
+			}
+			got, err := decrypt(key, sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decrypted content differs from the plaintext")
+			}
+		})
+	}
+}
+
+func TestReject(t *testing.T) {
+	key := newKey(t)
+	plain := make([]byte, 2*ChunkSize+123)
+	rand.Read(plain)
+	sealed := encrypt(t, key, plain)
+	chunk := ChunkSize + tagSize
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed func() []byte
+		want   error
+	}{
+		{"truncated last chunk", key, func() []byte {
+			return sealed[:len(sealed)-1]
+		}, ErrInvalidObject},
+		{"truncated at a chunk boundary", key, func() []byte {
+			return sealed[:headerSize+2*chunk]
+		}, ErrInvalidObject},
+		{"truncated header", key, func() []byte {
+			return sealed[:headerSize-1]
+		}, ErrInvalidObject},
+		{"extended", key, func() []byte {
+			return append(append([]byte(nil), sealed...), 0)
+		}, ErrInvalidObject},
+		{"reordered chunks", key, func() []byte {
+			b := append([]byte(nil), sealed...)
+			first := append([]byte(nil), b[headerSize:headerSize+chunk]...)
+			copy(b[headerSize:], b[headerSize+chunk:headerSize+2*chunk])
+			copy(b[headerSize+chunk:], first)
+			return b
+		}, ErrInvalidObject},
+		{"wrong key", newKey(t), func() []byte {
+			return sealed
+		}, ErrInvalidObject},
+		{"tampered magic", key, func() []byte {
+			b := append([]byte(nil), sealed...)
+			b[0] ^= 1
+			return b
+		}, ErrInvalidObject},
+		{"tampered chunk size", key, func() []byte {
+			b := append([]byte(nil), sealed...)
+			b[len(magic)+3] ^= 1
+			return b
+		}, ErrInvalidObject},
+		{"tampered salt", key, func() []byte {
+			b := append([]byte(nil), sealed...)
+			b[headerSize-1] ^= 1
+			return b
+		}, ErrInvalidObject},
+		{"tampered content", key, func() []byte {
+			b := append([]byte(nil), sealed...)
+			b[headerSize+chunk+1] ^= 1
+			return b
+		}, ErrInvalidObject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(tt.key, tt.sealed()); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectUnknownVersion(t *testing.T) {
+	key := newKey(t)
+	sealed := encrypt(t, key, []byte("s3ync"))
+	sealed[len(magic)]++
+	_, err := decrypt(key, sealed)
+	var unknown *UnknownVersionError
+	if !errors.As(err, &unknown) || unknown.Version != version+1 {
+		t.Errorf("got %v, want UnknownVersionError of version %d", err, version+1)
+	}
+}
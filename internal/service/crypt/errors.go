@@ -0,0 +1,27 @@
+package crypt
+
+import "fmt"
+
+// InvalidKeyFileError represents an error when a key can not be read from its file.
+type InvalidKeyFileError struct {
+	File string
+	Err  error
+}
+
+// Allow InvalidKeyFileError to satisfy error interface.
+func (e *InvalidKeyFileError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Couldn't read the key file %q: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("The key file %q must hold a 256-bit key, raw or base64 encoded", e.File)
+}
+
+// UnknownVersionError represents an error when an object is encrypted by a newer version of s3ync.
+type UnknownVersionError struct {
+	Version int
+}
+
+// Allow UnknownVersionError to satisfy error interface.
+func (e *UnknownVersionError) Error() string {
+	return fmt.Sprintf("The object is encrypted with the version %d of the format, upgrade s3ync to decrypt it", e.Version)
+}
@@ -0,0 +1,13 @@
+package gcp
+
+import "fmt"
+
+// GCSClientFailedError represents an error when trying to start a client of Google Cloud Storage.
+type GCSClientFailedError struct {
+	Err error
+}
+
+// Allow GCSClientFailedError to satisfy error interface.
+func (e *GCSClientFailedError) Error() string {
+	return fmt.Sprintf("Failed to start a gcs client: %q", e.Err)
+}
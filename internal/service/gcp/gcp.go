@@ -0,0 +1,187 @@
+// Package gcp is the storage backend of the syncs whose bucket is a bucket of Google Cloud Storage.
+package gcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// defaultChunkSize is the size of the chunks of resumable uploads when the sync does not set the part size.
+// Files larger than a chunk are uploaded in a resumable upload, the smaller ones in a single request.
+const defaultChunkSize = 16 << 20
+
+func init() {
+	storage.RegisterTransient(isTransient)
+}
+
+// isTransient reports whether an operation of a bucket may succeed when it is tried again:
+// network errors, timeouts, throttling and 5xx responses.
+func isTransient(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusRequestTimeout || apiErr.Code == http.StatusTooManyRequests) {
+		return true
+	}
+	var netErr net.Error
+	return gcs.ShouldRetry(err) || errors.As(err, &netErr)
+}
+
+// Client is the client of Google Cloud Storage of a profile.
+type Client struct {
+	client *gcs.Client
+}
+
+// NewClient returns the client of the profile, authorized by its service account file
+// or by the application default credentials.
+func NewClient(p *config.GCPProfile) (*Client, error) {
+	var opts []option.ClientOption
+	if p.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(p.Endpoint))
+	}
+	switch {
+	case p.CredentialsFile != "":
+		opts = append(opts, option.WithCredentialsFile(p.CredentialsFile))
+	case p.Endpoint != "":
+		// An emulator, ex. fake-gcs-server, does not authorize the requests.
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	client, err := gcs.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, &GCSClientFailedError{Err: err}
+	}
+	return &Client{client: client}, nil
+}
+
+// Bucket returns the bucket as a storage backend.
+func (c *Client) Bucket(name string) *Bucket {
+	return &Bucket{bucket: c.client.Bucket(name)}
+}
+
+// Bucket is a bucket of Google Cloud Storage, the storage backend of the syncs whose backend is gcp.
+type Bucket struct {
+	bucket *gcs.BucketHandle
+}
+
+var _ storage.Backend = (*Bucket)(nil)
+
+// Put uploads r into the object of the key and returns the ETag of the object.
+// Content larger than a chunk is sent in a resumable upload, one chunk at a time, so a failed chunk
+// is sent again instead of the whole file. The parts of a file are not uploaded in parallel.
+func (b *Bucket) Put(key string, r io.Reader, size int64, opts storage.UploadOptions) (string, error) {
+	w := b.bucket.Object(key).NewWriter(context.Background())
+	chunkSize := opts.PartSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	w.ChunkSize = int(chunkSize)
+	if size <= chunkSize {
+		// The object is sent in a single request, its content is not buffered.
+		w.ChunkSize = 0
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return etag(w.Attrs()), nil
+}
+
+// Get returns the content of the object of the key.
+func (b *Bucket) Get(key string) (io.ReadCloser, error) {
+	r, err := b.bucket.Object(key).NewReader(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, storage.ErrNotFound
+	}
+	return r, err
+}
+
+// Head returns the metadata of the object of the key.
+func (b *Bucket) Head(key string) (*storage.ObjectInfo, error) {
+	attrs, err := b.bucket.Object(key).Attrs(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	object := objectInfo(attrs)
+	return &object, nil
+}
+
+// List returns the metadata of every object whose key starts with prefix. Key: object key
+func (b *Bucket) List(prefix string) (map[string]storage.ObjectInfo, error) {
+	objects := make(map[string]storage.ObjectInfo)
+	it := b.bucket.Objects(context.Background(), &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects[attrs.Name] = objectInfo(attrs)
+	}
+}
+
+// Delete deletes the objects of the keys.
+func (b *Bucket) Delete(keys []string) error {
+	for _, key := range keys {
+		err := b.bucket.Object(key).Delete(context.Background())
+		if err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy copies the object of the key src to the key dst in the bucket. Large objects are rewritten
+// by the service in several requests, the content is never downloaded.
+func (b *Bucket) Copy(src, dst string, size int64) (string, error) {
+	attrs, err := b.bucket.Object(dst).CopierFrom(b.bucket.Object(src)).Run(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return "", storage.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return etag(attrs), nil
+}
+
+// ETagIsMD5 reports true, the ETags of the objects are their MD5, see etag.
+func (b *Bucket) ETagIsMD5() bool {
+	return true
+}
+
+func objectInfo(attrs *gcs.ObjectAttrs) storage.ObjectInfo {
+	return storage.ObjectInfo{
+		Size:         attrs.Size,
+		LastModified: attrs.Updated,
+		ETag:         etag(attrs),
+	}
+}
+
+// etag returns the hex MD5 of the content of the object, like the ETag of an object of S3 uploaded
+// in a single part, so the touched files are compared with their objects by their hash.
+// Composite objects have no MD5, their ETag is returned.
+func etag(attrs *gcs.ObjectAttrs) string {
+	if attrs == nil {
+		return ""
+	}
+	if len(attrs.MD5) != 0 {
+		return hex.EncodeToString(attrs.MD5)
+	}
+	return attrs.Etag
+}
@@ -0,0 +1,13 @@
+package ignore
+
+import "fmt"
+
+// InvalidPatternError represents an error when a pattern ends with a backslash that escapes nothing.
+type InvalidPatternError struct {
+	Pattern string
+}
+
+// Allow InvalidPatternError to satisfy error interface.
+func (e *InvalidPatternError) Error() string {
+	return fmt.Sprintf("The pattern %q ends with a backslash, use \\\\ to match a backslash", e.Pattern)
+}
@@ -0,0 +1,252 @@
+// Package ignore decides which paths of a sync are not synced. A path is ignored by the
+// exclude patterns of its sync or by the .s3yncignore files of its directories, which use
+// the gitignore syntax, or when its sync has include patterns and the path matches none of them.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FileName is the name of the ignore files in the synced directories.
+const FileName = ".s3yncignore"
+
+// rule is a pattern of an ignore file or of the config file.
+type rule struct {
+	base    string // directory of the ignore file relative to the root of the sync, empty for the root
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// match reports whether the path relative to the root of the sync matches the rule.
+func (r *rule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+	return r.re.MatchString(rel)
+}
+
+// Matcher matches the paths of a sync against its patterns.
+type Matcher struct {
+	root    string // local root path of the sync
+	include []*rule
+	exclude []*rule
+
+	mu    sync.Mutex
+	files map[string][]*rule // rules of the ignore files. Key: directory relative to the root
+}
+
+// New returns the Matcher of the sync whose local root path is root.
+func New(root string, include, exclude []string) (*Matcher, error) {
+	m := &Matcher{root: root, files: make(map[string][]*rule)}
+	for _, p := range include {
+		r, err := parse(p, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			m.include = append(m.include, r)
+		}
+	}
+	for _, p := range exclude {
+		r, err := parse(p, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			m.exclude = append(m.exclude, r)
+		}
+	}
+	return m, nil
+}
+
+// Ignored reports whether the path relative to the root of the sync is not synced.
+// The paths in an ignored directory are ignored, and the include patterns apply to files only.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.excluded(parts[:i], true) {
+			return true
+		}
+	}
+	if m.excluded(parts, isDir) {
+		return true
+	}
+	if !isDir && len(m.include) != 0 {
+		for _, r := range m.include {
+			if r.match(rel, false) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Invalidate forgets the rules of the ignore file of the directory relative to the root, after it is changed.
+func (m *Matcher) Invalidate(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, strings.Trim(filepath.ToSlash(dir), "/"))
+}
+
+// excluded applies the exclude patterns, then the ignore files from the root to the directory of the path.
+// The last matching rule wins, so a deeper ignore file overrides the ones above.
+func (m *Matcher) excluded(parts []string, isDir bool) bool {
+	rel := strings.Join(parts, "/")
+	ignored := false
+	apply := func(rules []*rule) {
+		for _, r := range rules {
+			if r.match(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	apply(m.exclude)
+	for i := 0; i < len(parts); i++ {
+		apply(m.rules(strings.Join(parts[:i], "/")))
+	}
+	return ignored
+}
+
+// rules returns the rules of the ignore file of the directory, it is read at the first use.
+func (m *Matcher) rules(dir string) []*rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules, ok := m.files[dir]
+	if ok {
+		return rules
+	}
+	rules, _ = readFile(filepath.Join(m.root, filepath.FromSlash(dir), FileName), dir)
+	m.files[dir] = rules
+	return rules
+}
+
+// readFile reads the rules of an ignore file, a missing file has no rules.
+func readFile(path, base string) ([]*rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []*rule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// An invalid line is skipped like git does.
+		if r, err := parse(scanner.Text(), base); err == nil && r != nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// parse parses a gitignore pattern, it returns nil for blank lines and comments.
+func parse(pattern, base string) (*rule, error) {
+	p := strings.TrimRight(pattern, "\r")
+	if t := strings.TrimRight(p, " "); t != p && escaped(t) {
+		// A trailing space escaped with a backslash is kept.
+		p = t + " "
+	} else {
+		p = t
+	}
+	if p == "" || strings.HasPrefix(p, "#") {
+		return nil, nil
+	}
+	if escaped(p) {
+		// The backslash escapes nothing, git never matches the pattern.
+		return nil, &InvalidPatternError{Pattern: pattern}
+	}
+	r := &rule{base: base}
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	// A pattern with a slash other than a trailing one is relative to the directory of its file,
+	// otherwise it matches a name at any depth.
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, nil
+	}
+	re, err := compile(p, anchored)
+	if err != nil {
+		return nil, err
+	}
+	r.re = re
+	return r, nil
+}
+
+// escaped reports whether the pattern ends with a backslash that is not itself escaped.
+func escaped(p string) bool {
+	n := len(p) - len(strings.TrimRight(p, `\`))
+	return n%2 == 1
+}
+
+// compile converts a glob to a regular expression matching slash separated paths.
+// * and ? do not match a slash, ** matches any number of directories.
+func compile(p string, anchored bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(p[i:], "**/"):
+				b.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(p[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(p[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(p) {
+				i++
+				b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,98 @@
+package ignore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		files   map[string]string // ignore files. Key: directory relative to the root
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{name: "negation", exclude: []string{"*.log", "!keep.log"}, path: "a.log", want: true},
+		{name: "negation of a match", exclude: []string{"*.log", "!keep.log"}, path: "keep.log", want: false},
+		{name: "negation in an ignored directory", exclude: []string{"out/", "!out/keep.log"}, path: "out/keep.log", want: true},
+
+		{name: "leading **", exclude: []string{"**/tmp"}, path: "a/b/tmp", isDir: true, want: true},
+		{name: "middle ** matches no directory", exclude: []string{"a/**/b"}, path: "a/b", want: true},
+		{name: "middle ** matches directories", exclude: []string{"a/**/b"}, path: "a/x/y/b", want: true},
+		{name: "trailing **", exclude: []string{"logs/**"}, path: "logs/x/y.txt", want: true},
+		{name: "* does not match a slash", exclude: []string{"a/*.txt"}, path: "a/b/c.txt", want: false},
+
+		{name: "leading slash anchors", exclude: []string{"/build"}, path: "build", isDir: true, want: true},
+		{name: "leading slash does not match deeper", exclude: []string{"/build"}, path: "src/build", isDir: true, want: false},
+		{name: "middle slash anchors", exclude: []string{"doc/*.txt"}, path: "x/doc/a.txt", want: false},
+		{name: "no slash matches at any depth", exclude: []string{"build"}, path: "src/build", isDir: true, want: true},
+
+		{name: "directory-only rule matches a directory", exclude: []string{"cache/"}, path: "cache", isDir: true, want: true},
+		{name: "directory-only rule does not match a file", exclude: []string{"cache/"}, path: "cache", want: false},
+		{name: "directory-only rule ignores the paths under it", exclude: []string{"cache/"}, path: "cache/a/b.txt", want: true},
+
+		{name: "escaped trailing space is kept", exclude: []string{`foo\ `}, path: "foo ", want: true},
+		{name: "escaped trailing space is required", exclude: []string{`foo\ `}, path: "foo", want: false},
+		{name: "unescaped trailing spaces are trimmed", exclude: []string{"bar   "}, path: "bar", want: true},
+		{name: "escaped backslash before a trailing space", exclude: []string{`foo\\ `}, path: `foo\`, want: true},
+		{name: "trailing backslash in an ignore file is skipped", files: map[string]string{"": "foo\\\n"}, path: "foo ", want: false},
+
+		{name: "ignore file", files: map[string]string{"": "*.tmp\n"}, path: "sub/a.tmp", want: true},
+		{name: "nested ignore file overrides the root", files: map[string]string{"": "*.tmp\n", "sub": "!keep.tmp\n"}, path: "sub/keep.tmp", want: false},
+		{name: "nested ignore file does not apply above", files: map[string]string{"": "*.tmp\n", "sub": "!keep.tmp\n"}, path: "keep.tmp", want: true},
+		{name: "nested ignore file anchors to its directory", files: map[string]string{"sub": "/x\n"}, path: "sub/x", want: true},
+		{name: "nested anchored rule does not match deeper", files: map[string]string{"sub": "/x\n"}, path: "sub/y/x", want: false},
+		{name: "ignore file overrides the exclude patterns", exclude: []string{"*.tmp"}, files: map[string]string{"": "!a.tmp\n"}, path: "a.tmp", want: false},
+
+		{name: "include skips the other files", include: []string{"*.go"}, path: "a.txt", want: true},
+		{name: "include keeps the matching files", include: []string{"*.go"}, path: "src/a.go", want: false},
+		{name: "include does not apply to directories", include: []string{"*.go"}, path: "src", isDir: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for dir, content := range tt.files {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, dir, FileName), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m, err := New(root, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrailingBackslash(t *testing.T) {
+	tests := []struct {
+		pattern string
+		invalid bool
+	}{
+		{pattern: `foo\`, invalid: true},
+		{pattern: `foo\\\`, invalid: true},
+		{pattern: `foo\\`},
+		{pattern: `foo\ `},
+		{pattern: `# comment\`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := parse(tt.pattern, "")
+			var invalid *InvalidPatternError
+			if errors.As(err, &invalid) != tt.invalid || (!tt.invalid && err != nil) {
+				t.Errorf("parse(%q) returned %v, want an InvalidPatternError: %v", tt.pattern, err, tt.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package localfs
+
+import "fmt"
+
+// InvalidKeyError represents an error when a key is not a path inside the directory of the backend.
+type InvalidKeyError struct {
+	Key string
+}
+
+// Allow InvalidKeyError to satisfy error interface.
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("%q is not a path inside the directory", e.Key)
+}
@@ -0,0 +1,223 @@
+// Package localfs is the storage backend of the syncs mirrored into another local directory,
+// ex. a NAS mount or an external disk. The keys of the objects are the paths of the files
+// relative to the directory.
+package localfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// tempPrefix is the prefix of the files being written, they are renamed to their key once they are complete.
+const tempPrefix = ".s3ync-tmp-"
+
+// Dir is a local directory, the storage backend of the syncs whose backend is local.
+type Dir struct {
+	root string
+}
+
+var _ storage.Backend = (*Dir)(nil)
+
+// New returns the backend of the directory, it is created when the first file is put.
+func New(root string) *Dir {
+	return &Dir{root: filepath.Clean(filepath.FromSlash(root))}
+}
+
+// path returns the path of the file of the key.
+func (d *Dir) path(key string) (string, error) {
+	if key == "" || !fs.ValidPath(strings.TrimSuffix(key, "/")) {
+		return "", &InvalidKeyError{Key: key}
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes r into the file of the key. The content is written to a temporary file renamed to the key,
+// so the file of the key is never half-written and the files linked by Copy are never changed.
+func (d *Dir) Put(key string, r io.Reader, size int64, opts storage.UploadOptions) (string, error) {
+	name, err := d.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), tempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	return etag(info), nil
+}
+
+// Get opens the file of the key.
+func (d *Dir) Get(key string) (io.ReadCloser, error) {
+	name, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	}
+	return f, err
+}
+
+// Head returns the metadata of the file of the key.
+func (d *Dir) Head(key string) (*storage.ObjectInfo, error) {
+	name, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	object := objectInfo(info)
+	return &object, nil
+}
+
+// List returns the metadata of every file whose key starts with prefix. Key: object key
+func (d *Dir) List(prefix string) (map[string]storage.ObjectInfo, error) {
+	objects := make(map[string]storage.ObjectInfo)
+	// Only the directory of the prefix is walked, the prefix may end in the middle of a name.
+	dir := d.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		name, err := d.path(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = name
+	}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), tempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			objects[key] = objectInfo(info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Delete removes the files of the keys, then the directories left empty by them.
+func (d *Dir) Delete(keys []string) error {
+	for _, key := range keys {
+		name, err := d.path(key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		d.removeEmptyDirs(path.Dir(key))
+	}
+	return nil
+}
+
+// removeEmptyDirs removes the directory of the key and its parents as long as they are empty.
+// The root is never removed.
+func (d *Dir) removeEmptyDirs(dir string) {
+	for dir != "." && dir != "/" {
+		name, err := d.path(dir)
+		if err != nil || os.Remove(name) != nil {
+			// The directory is not empty.
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// Copy links the file of the key src to the key dst, the files are never changed once they are put.
+// The content is copied where links are not supported.
+func (d *Dir) Copy(src, dst string, size int64) (string, error) {
+	from, err := d.path(src)
+	if err != nil {
+		return "", err
+	}
+	to, err := d.path(dst)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return "", err
+	}
+	os.Remove(to)
+	if err := os.Link(from, to); err == nil {
+		info, err := os.Stat(to)
+		if err != nil {
+			return "", err
+		}
+		return etag(info), nil
+	}
+	f, err := os.Open(from)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", storage.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return d.Put(dst, f, size, storage.UploadOptions{})
+}
+
+// ETagIsMD5 reports false, the ETags of the files are made of their size and mtime, see etag.
+func (d *Dir) ETagIsMD5() bool {
+	return false
+}
+
+func objectInfo(info os.FileInfo) storage.ObjectInfo {
+	return storage.ObjectInfo{
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ETag:         etag(info),
+	}
+}
+
+// etag identifies the content of a file by its size and mtime, as hashing every listed file is too slow.
+// It is not an MD5, so it is never compared with the hash of a local file.
+func etag(info os.FileInfo) string {
+	return fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano())
+}
@@ -0,0 +1,265 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxDeleteObjects is the most keys DeleteObjects accepts in a request.
+const maxDeleteObjects = 1000
+
+// Bucket is an S3 bucket, the storage backend of the syncs whose backend is s3.
+type Bucket struct {
+	basics  *BucketBasics
+	profile string
+	name    string
+	sse     *sse // server-side encryption of the objects
+
+	mu     sync.Mutex
+	client *s3.Client // client of the region of the bucket
+}
+
+var _ storage.Backend = (*Bucket)(nil)
+
+// do runs op with the client of the region of the bucket. When the bucket redirects the request
+// to its region, the client of the region replaces the client of the bucket and op runs again
+// if rerun is true. An upload of a reader that can't be read again can't run again.
+func (b *Bucket) do(rerun bool, op func(client *s3.Client) error) error {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	err := op(client)
+	region := b.redirected(err)
+	if region == "" || region == client.Options().Region {
+		return err
+	}
+	regional, cerr := b.basics.client(b.profile, region)
+	if cerr != nil {
+		return err
+	}
+	fmt.Printf("The bucket %v is in %v, not in %v. Its requests are sent to %v.\n", b.name, region, client.Options().Region, region)
+	b.mu.Lock()
+	b.client = regional
+	b.mu.Unlock()
+	if !rerun {
+		return err
+	}
+	return op(regional)
+}
+
+// redirected returns the region of the bucket if the request failing with err is sent to another region,
+// or an empty string. S3 names the region in the x-amz-bucket-region header of the response; a redirect
+// without the header is answered by asking the bucket for its region.
+func (b *Bucket) redirected(err error) string {
+	var re *awshttp.ResponseError
+	if !errors.As(err, &re) || re.Response == nil {
+		return ""
+	}
+	switch re.HTTPStatusCode() {
+	case http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusBadRequest:
+		// 400 is AuthorizationHeaderMalformed, the request is signed for another region.
+		if region := re.Response.Header.Get("x-amz-bucket-region"); region != "" {
+			return region
+		}
+	}
+	if re.HTTPStatusCode() != http.StatusMovedPermanently {
+		return ""
+	}
+	region, rerr := b.basics.BucketRegion(b.name, b.profile)
+	if rerr != nil {
+		return ""
+	}
+	return region
+}
+
+// Put streams r into the object of the key and returns the ETag of the object.
+// Content larger than the part size is uploaded in parts, so it is never read into memory.
+func (b *Bucket) Put(key string, r io.Reader, size int64, opts storage.UploadOptions) (string, error) {
+	// The upload runs again in the region of the bucket from the start of the reader.
+	seeker, rerun := r.(io.Seeker)
+	start := int64(0)
+	if rerun {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return "", err
+		}
+	}
+	var etag string
+	err := b.do(rerun, func(client *s3.Client) error {
+		if rerun {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+			if opts.PartSize > 0 {
+				u.PartSize = opts.PartSize
+			}
+			if opts.Concurrency > 0 {
+				u.Concurrency = opts.Concurrency
+			}
+		})
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(b.name),
+			Key:    aws.String(key),
+			Body:   r,
+		}
+		// The uploader sets the encryption of the input on the parts of multipart uploads as well.
+		b.sse.put(input)
+		out, err := uploader.Upload(context.Background(), input)
+		if err != nil {
+			return err
+		}
+		etag = aws.ToString(out.ETag)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Couldn't upload to %v:%v. Here's why: %v\n", b.name, key, err)
+		return "", err
+	}
+	return etag, nil
+}
+
+// Get returns the content of the object of the key.
+func (b *Bucket) Get(key string) (io.ReadCloser, error) {
+	var out *s3.GetObjectOutput
+	err := b.do(true, func(client *s3.Client) (err error) {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(b.name),
+			Key:    aws.String(key),
+		}
+		b.sse.getObject(input)
+		out, err = client.GetObject(context.Background(), input)
+		return err
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Head returns the metadata of the object of the key.
+func (b *Bucket) Head(key string) (*storage.ObjectInfo, error) {
+	var out *s3.HeadObjectOutput
+	err := b.do(true, func(client *s3.Client) (err error) {
+		input := &s3.HeadObjectInput{
+			Bucket: aws.String(b.name),
+			Key:    aws.String(key),
+		}
+		b.sse.headObject(input)
+		out, err = client.HeadObject(context.Background(), input)
+		return err
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &storage.ObjectInfo{
+		Size:         aws.ToInt64(out.ContentLength),
+		LastModified: aws.ToTime(out.LastModified),
+		ETag:         aws.ToString(out.ETag),
+	}, nil
+}
+
+// List returns the metadata of every object whose key starts with prefix. Key: object key
+func (b *Bucket) List(prefix string) (map[string]storage.ObjectInfo, error) {
+	var objects map[string]storage.ObjectInfo
+	err := b.do(true, func(client *s3.Client) error {
+		objects = make(map[string]storage.ObjectInfo)
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(b.name),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.Background())
+			if err != nil {
+				return err
+			}
+			for _, object := range page.Contents {
+				objects[aws.ToString(object.Key)] = storage.ObjectInfo{
+					Size:         aws.ToInt64(object.Size),
+					LastModified: aws.ToTime(object.LastModified),
+					ETag:         aws.ToString(object.ETag),
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Delete deletes the objects of the keys, in batches of the most keys a request accepts.
+func (b *Bucket) Delete(keys []string) error {
+	return b.do(true, func(client *s3.Client) error {
+		return deleteObjects(client, b.name, keys)
+	})
+}
+
+// deleteObjects deletes the objects of the keys from the bucket with the client.
+func deleteObjects(client *s3.Client, bucket string, keys []string) error {
+	ctx := context.Background()
+	if len(keys) == 1 {
+		_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(keys[0]),
+		})
+		return err
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), maxDeleteObjects)
+		objects := make([]types.ObjectIdentifier, n)
+		for i, key := range keys[:n] {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) != 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("couldn't delete %v:%v: %v", bucket, aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// Copy copies the object of the key src to the key dst in the bucket, in parts if it is large.
+func (b *Bucket) Copy(src, dst string, size int64) (string, error) {
+	var etag string
+	err := b.do(true, func(client *s3.Client) (err error) {
+		etag, err = copyObject(context.Background(), client, b.sse, b.name, src, dst, size)
+		return err
+	})
+	return etag, err
+}
+
+// ETagIsMD5 reports whether the ETags of the objects are the MD5 of their content,
+// the ETags of the objects encrypted with a KMS or a customer key are not.
+func (b *Bucket) ETagIsMD5() bool {
+	return b.sse == nil || b.sse.algorithm == types.ServerSideEncryptionAes256
+}
@@ -0,0 +1,144 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	s3yncconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ProbePrefix is the prefix of the key of the object written to check that a profile can write to a bucket.
+const ProbePrefix = ".s3ync-probe-"
+
+// CheckBucket checks that the profile can use the bucket for a sync and returns the region of the bucket.
+// The bucket is created in the region of the profile if it does not exist and create is true.
+// An object, encrypted with enc, is written to the bucket and deleted to check the permissions of the profile.
+func (b *BucketBasics) CheckBucket(name, profile string, create bool, enc *s3yncconfig.Encryption) (string, error) {
+	sse, err := newSSE(enc)
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+	region, err := b.BucketRegion(name, profile)
+	if err != nil {
+		if !isNotFound(err) {
+			return "", bucketError(name, profile, "", "s3:GetBucketLocation", err)
+		}
+		if !create {
+			return "", &BucketNotFoundError{Bucket: name, Profile: profile}
+		}
+		if region, err = b.createBucket(ctx, name, profile); err != nil {
+			return "", err
+		}
+	}
+	client, err := b.client(profile, region)
+	if err != nil {
+		return "", err
+	}
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)}); err != nil {
+		if isNotFound(err) {
+			// The S3 compatible servers have no region to detect, the bucket is found by HeadBucket only.
+			if !create {
+				return "", &BucketNotFoundError{Bucket: name, Profile: profile}
+			}
+			if region, err = b.createBucket(ctx, name, profile); err != nil {
+				return "", err
+			}
+			if client, err = b.client(profile, region); err != nil {
+				return "", err
+			}
+		} else {
+			return "", bucketError(name, profile, region, "s3:ListBucket", err)
+		}
+	}
+
+	key := fmt.Sprintf("%v%d", ProbePrefix, time.Now().UnixNano())
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(name),
+		Key:    aws.String(key),
+		Body:   strings.NewReader("s3ync"),
+	}
+	sse.put(input)
+	if _, err := client.PutObject(ctx, input); err != nil {
+		return "", bucketError(name, profile, region, "s3:PutObject", err)
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return region, bucketError(name, profile, region, "s3:DeleteObject", err)
+	}
+	return region, nil
+}
+
+// createBucket creates the bucket in the region of the profile and returns the region.
+func (b *BucketBasics) createBucket(ctx context.Context, name, profile string) (string, error) {
+	client, err := b.client(profile, "")
+	if err != nil {
+		return "", err
+	}
+	region := client.Options().Region
+	input := &s3.CreateBucketInput{Bucket: aws.String(name)}
+	if region != defaultRegion {
+		// The buckets of us-east-1 are created without a location constraint.
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+	if _, err := client.CreateBucket(ctx, input); err != nil {
+		var owned *types.BucketAlreadyOwnedByYou
+		if !errors.As(err, &owned) {
+			return "", bucketError(name, profile, region, "s3:CreateBucket", err)
+		}
+	}
+	return region, nil
+}
+
+// bucketError returns the error of the request of the action to the bucket as a BucketNotFoundError,
+// a WrongRegionError or an AccessDeniedError when it is one. region is the region of the request.
+func bucketError(name, profile, region, action string, err error) error {
+	if isNotFound(err) {
+		return &BucketNotFoundError{Bucket: name, Profile: profile}
+	}
+	var re *awshttp.ResponseError
+	if !errors.As(err, &re) || re.Response == nil {
+		return err
+	}
+	actual := re.Response.Header.Get("x-amz-bucket-region")
+	switch re.HTTPStatusCode() {
+	case http.StatusForbidden:
+		return &AccessDeniedError{Bucket: name, Profile: profile, Action: action, Err: err}
+	case http.StatusMovedPermanently, http.StatusTemporaryRedirect:
+		return &WrongRegionError{Bucket: name, Region: region, Actual: actual}
+	case http.StatusBadRequest:
+		// AuthorizationHeaderMalformed, the request is signed for another region than the bucket's.
+		if actual != "" && actual != region {
+			return &WrongRegionError{Bucket: name, Region: region, Actual: actual}
+		}
+	}
+	return err
+}
+
+// isNotFound reports whether the request failed because the bucket does not exist.
+func isNotFound(err error) bool {
+	var notFound manager.BucketNotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &noSuchBucket) {
+		return true
+	}
+	var re *awshttp.ResponseError
+	return errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound
+}
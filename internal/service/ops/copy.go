@@ -0,0 +1,110 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// multipartCopyThreshold is the size above which objects are copied in parts.
+	// CopyObject is limited to 5 GiB, the parts of large objects are copied in parallel.
+	multipartCopyThreshold = 1 << 30
+	copyPartSize           = 256 << 20
+	copyConcurrency        = 5
+)
+
+// copyObject copies the object of the key src to the key dst in the bucket, without downloading it.
+// size is the size of the object, it is copied in parts if it is large. The copy is encrypted with enc,
+// the source is read with its customer key if it has one. It returns the ETag of the copy.
+func copyObject(ctx context.Context, client *s3.Client, enc *sse, bucket, src, dst string, size int64) (string, error) {
+	source := aws.String(url.PathEscape(bucket + "/" + src))
+	if size <= multipartCopyThreshold {
+		input := &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			CopySource: source,
+			Key:        aws.String(dst),
+		}
+		enc.copyObject(input)
+		out, err := client.CopyObject(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(out.CopyObjectResult.ETag), nil
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(dst),
+	}
+	enc.createMultipartUpload(create)
+	upload, err := client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]types.CompletedPart, (size+copyPartSize-1)/copyPartSize)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, copyConcurrency)
+	)
+	for i := range parts {
+		first := int64(i) * copyPartSize
+		last := first + copyPartSize - 1
+		if last >= size {
+			last = size - 1
+		}
+		number := aws.Int32(int32(i + 1))
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, first, last int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			input := &s3.UploadPartCopyInput{
+				Bucket:          aws.String(bucket),
+				Key:             aws.String(dst),
+				UploadId:        upload.UploadId,
+				PartNumber:      number,
+				CopySource:      source,
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+			}
+			enc.uploadPartCopy(input)
+			out, err := client.UploadPartCopy(ctx, input)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			parts[i] = types.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: number}
+		}(i, first, last)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		// The copied parts are stored until the upload is aborted.
+		client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(dst),
+			UploadId: upload.UploadId,
+		})
+		return "", firstErr
+	}
+	out, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(dst),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.ETag), nil
+}
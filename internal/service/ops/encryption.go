@@ -0,0 +1,108 @@
+package ops
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+
+	s3yncconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/crypt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// sse is the server-side encryption of the objects of a bucket, it is set on the requests that write
+// the objects and, with a customer key, on the requests that read them. A nil sse sets nothing.
+type sse struct {
+	algorithm types.ServerSideEncryption // SSE-S3 and SSE-KMS
+	kmsKeyID  *string
+	bucketKey *bool
+	// customerKey and customerKeyMD5 are the base64 encoded SSE-C key and its MD5.
+	customerKey    *string
+	customerKeyMD5 *string
+}
+
+// newSSE returns the server-side encryption of the settings, nil if e is nil. The key of SSE-C is read from its file.
+func newSSE(e *s3yncconfig.Encryption) (*sse, error) {
+	if e == nil {
+		return nil, nil
+	}
+	switch e.Type {
+	case s3yncconfig.EncryptionSSES3:
+		return &sse{algorithm: types.ServerSideEncryptionAes256}, nil
+	case s3yncconfig.EncryptionSSEKMS:
+		s := &sse{algorithm: types.ServerSideEncryptionAwsKms}
+		if e.KMSKeyID != "" {
+			s.kmsKeyID = aws.String(e.KMSKeyID)
+		}
+		if e.BucketKey {
+			s.bucketKey = aws.Bool(true)
+		}
+		return s, nil
+	}
+	key, err := crypt.ReadKeyFile(e.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(key)
+	return &sse{
+		customerKey:    aws.String(base64.StdEncoding.EncodeToString(key)),
+		customerKeyMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}, nil
+}
+
+// customerAlgorithm is the algorithm of the SSE-C requests, nil without a customer key.
+func (e *sse) customerAlgorithm() *string {
+	if e == nil || e.customerKey == nil {
+		return nil
+	}
+	return aws.String(string(types.ServerSideEncryptionAes256))
+}
+
+func (e *sse) put(in *s3.PutObjectInput) {
+	if e == nil {
+		return
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId, in.BucketKeyEnabled = e.algorithm, e.kmsKeyID, e.bucketKey
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
+
+func (e *sse) createMultipartUpload(in *s3.CreateMultipartUploadInput) {
+	if e == nil {
+		return
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId, in.BucketKeyEnabled = e.algorithm, e.kmsKeyID, e.bucketKey
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
+
+// copyObject sets the encryption of the copy, and the key of the source encrypted with the same customer key.
+func (e *sse) copyObject(in *s3.CopyObjectInput) {
+	if e == nil {
+		return
+	}
+	in.ServerSideEncryption, in.SSEKMSKeyId, in.BucketKeyEnabled = e.algorithm, e.kmsKeyID, e.bucketKey
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
+
+func (e *sse) uploadPartCopy(in *s3.UploadPartCopyInput) {
+	if e == nil {
+		return
+	}
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
+
+func (e *sse) getObject(in *s3.GetObjectInput) {
+	if e == nil {
+		return
+	}
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
+
+func (e *sse) headObject(in *s3.HeadObjectInput) {
+	if e == nil {
+		return
+	}
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = e.customerAlgorithm(), e.customerKey, e.customerKeyMD5
+}
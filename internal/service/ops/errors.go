@@ -11,3 +11,57 @@ type S3ClientFailedError struct {
 func (e *S3ClientFailedError) Error() string {
 	return fmt.Sprintf("Failed to start a s3 client: %q", e.Err)
 }
+
+// ProfileNotFoundError represents an error when there is no s3 client for an aws profile.
+type ProfileNotFoundError struct {
+	Profile string
+}
+
+// Allow ProfileNotFoundError to satisfy error interface.
+func (e *ProfileNotFoundError) Error() string {
+	return fmt.Sprintf("There is no s3 client for the profile %q, is it configured in aws cli?", e.Profile)
+}
+
+// BucketNotFoundError represents an error when the bucket of a sync does not exist.
+type BucketNotFoundError struct {
+	Bucket  string
+	Profile string
+}
+
+// Allow BucketNotFoundError to satisfy error interface.
+func (e *BucketNotFoundError) Error() string {
+	return fmt.Sprintf("The bucket %q does not exist (profile: %v). Check its name, or create it with --create-bucket", e.Bucket, e.Profile)
+}
+
+// WrongRegionError represents an error when the requests to a bucket are sent to another region than the bucket's.
+type WrongRegionError struct {
+	Bucket string
+	Region string // region of the requests
+	Actual string // region of the bucket, empty if S3 does not tell it
+}
+
+// Allow WrongRegionError to satisfy error interface.
+func (e *WrongRegionError) Error() string {
+	if e.Actual == "" {
+		return fmt.Sprintf("The bucket %q is not in the region %v", e.Bucket, e.Region)
+	}
+	return fmt.Sprintf("The bucket %q is in the region %v, not in %v", e.Bucket, e.Actual, e.Region)
+}
+
+// AccessDeniedError represents an error when the profile is not allowed an action on a bucket.
+type AccessDeniedError struct {
+	Bucket  string
+	Profile string
+	Action  string // s3 action denied, ex. s3:PutObject
+	Err     error
+}
+
+// Allow AccessDeniedError to satisfy error interface.
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("The profile %v is not allowed %v on the bucket %q: %v", e.Profile, e.Action, e.Bucket, e.Err)
+}
+
+// Allow AccessDeniedError to be unwrapped.
+func (e *AccessDeniedError) Unwrap() error {
+	return e.Err
+}
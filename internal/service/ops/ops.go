@@ -3,124 +3,241 @@ package ops
 import (
 	"bytes"
 	"context"
-	"fmt"
+	"crypto/tls"
+	"errors"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 
+	s3yncconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"gopkg.in/ini.v1"
 )
 
+// defaultRegion is the region of the clients of the profiles that have no region.
+// GetBucketLocation answers for the buckets of every region there.
+const defaultRegion = "us-east-1"
+
+// BucketBasics creates the s3 clients of the aws profiles. A profile has a client for every region
+// of its buckets, the clients are created when they are first needed.
 type BucketBasics struct {
-	Clients map[string]*s3.Client
+	mu       sync.Mutex
+	settings map[string]*s3yncconfig.S3Profile // endpoint settings of the s3ync config file. Key: aws profile
+	configs  map[string]aws.Config             // Key: aws profile
+	clients  map[clientKey]*s3.Client
+}
+
+type clientKey struct {
+	profile, region string
 }
 
+// NewBucketBasics reads the endpoint settings of the profiles from the s3ync config file.
 func NewBucketBasics() (*BucketBasics, error) {
-	profiles := GetLocalAwsProfiles()
-	b := BucketBasics{
-		Clients: make(map[string]*s3.Client),
-	}
-	for _, profile := range profiles {
-		err := b.AddClient(profile)
-		if err != nil {
-			return nil, err
-		}
+	settings, err := s3yncconfig.GetS3Profiles()
+	if err != nil {
+		return nil, err
 	}
-	return &b, nil
+	return &BucketBasics{
+		settings: settings,
+		configs:  make(map[string]aws.Config),
+		clients:  make(map[clientKey]*s3.Client),
+	}, nil
 }
 
+// GetLocalAwsProfiles returns the names of the profiles of the aws cli config file.
 func GetLocalAwsProfiles() []string {
-	fname := config.DefaultSharedConfigFilename()
-	f, err := ini.Load(fname)
+	f, err := loadAwsConfig()
 	if err != nil {
 		return nil
 	}
-	profiles := f.SectionStrings()
+	var profiles []string
+	for _, section := range f.Sections() {
+		if name, ok := profileName(section.Name()); ok {
+			profiles = append(profiles, name)
+		}
+	}
+	return profiles
+}
 
-	// There is no profile in config file
-	if len(profiles) == 1 && profiles[0] == "DEFAULT" {
+// GetLocalAwsProfilesWithDefaultRegion returns the profiles of the aws cli config file followed by their regions,
+// ["default", "us-east-1", "user1", "eu-west-1", ...]. The region of a profile without one is empty.
+func GetLocalAwsProfilesWithDefaultRegion() []string {
+	f, err := loadAwsConfig()
+	if err != nil {
 		return nil
 	}
+	var profiles []string
+	for _, section := range f.Sections() {
+		if name, ok := profileName(section.Name()); ok {
+			profiles = append(profiles, name, section.Key("region").String())
+		}
+	}
+	return profiles
+}
 
-	// ["DEFAULT", "default", "user1", ...]
-	return profiles[1:] // remove DEFAULT
+// IsAwsCliConfigured reports whether the aws cli config file exists and has a profile.
+func IsAwsCliConfigured() bool {
+	return len(GetLocalAwsProfiles()) > 0
 }
 
-func (b *BucketBasics) AddClient(profile string) error {
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithSharedConfigProfile(profile),
-	)
-	if err != nil {
-		return err
+// IsProfileExistInAwsConfig reports whether the profile is in the aws cli config file.
+func IsProfileExistInAwsConfig(profile string) bool {
+	for _, p := range GetLocalAwsProfiles() {
+		if p == profile {
+			return true
+		}
 	}
-	b.Clients[profile] = s3.NewFromConfig(cfg)
-	return nil
+	return false
 }
 
-// UploadFile reads from a file and puts the data into an object in a bucket.
-func (b *BucketBasics) UploadFile(bucketName, objectKey, fileName, profile string) error {
-	file, err := os.ReadFile(fileName)
-	if err != nil {
-		fmt.Printf("Couldn't open file %v to upload. Here's why: %v\n", fileName, err)
-	} else {
-		_, err = b.Clients[profile].PutObject(context.Background(), &s3.PutObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(objectKey),
-			Body:   bytes.NewReader(file),
-		})
-		if err != nil {
-			fmt.Printf("Couldn't upload file %v to %v:%v. Here's why: %v\n",
-				fileName, bucketName, objectKey, err)
-		}
+// loadAwsConfig loads the aws cli config file, AWS_CONFIG_FILE if it is set.
+func loadAwsConfig() (*ini.File, error) {
+	fname := os.Getenv("AWS_CONFIG_FILE")
+	if fname == "" {
+		fname = config.DefaultSharedConfigFilename()
 	}
-	return err
+	return ini.Load(fname)
 }
 
-// DeleteFile deletes a file from S3.
-func (b *BucketBasics) DeleteFile(bucket, key, profile string) error {
-	_, err := b.Clients[profile].DeleteObject(context.Background(),
-		&s3.DeleteObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		})
-	return err
+// profileName returns the name of the profile of the section of the aws cli config file.
+// The sections are "default" and "profile user1", the other sections (DEFAULT, sso-session, services) are not profiles.
+func profileName(section string) (string, bool) {
+	if section == "default" {
+		return section, true
+	}
+	if name, ok := strings.CutPrefix(section, "profile "); ok {
+		name = strings.TrimSpace(name)
+		return name, name != ""
+	}
+	return "", false
 }
 
-func (b *BucketBasics) DeleteDirectory(bucket, key, profile string) error {
-	ctx := context.Background()
-	listObjectsInput := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(key),
+// AddClient loads the config of the aws profile, its clients are created from it.
+// p, if not nil, points the clients to an S3 compatible server.
+func (b *BucketBasics) AddClient(profile string, p *s3yncconfig.S3Profile) error {
+	opts := []func(*config.LoadOptions) error{config.WithSharedConfigProfile(profile)}
+	if p != nil && p.InsecureTLS {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		})))
 	}
-	paginator := s3.NewListObjectsV2Paginator(b.Clients[profile], listObjectsInput)
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+	if p != nil && p.CABundle != "" {
+		bundle, err := os.ReadFile(p.CABundle)
 		if err != nil {
 			return err
 		}
+		opts = append(opts, config.WithCustomCABundle(bytes.NewReader(bundle)))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		var notExist config.SharedConfigProfileNotExistError
+		if errors.As(err, &notExist) {
+			return &ProfileNotFoundError{Profile: profile}
+		}
+		return err
+	}
+	if cfg.Region == "" {
+		// The S3 compatible servers mostly ignore the region, the requests are signed with one anyway.
+		cfg.Region = defaultRegion
+	}
+	b.configs[profile] = cfg
+	return nil
+}
+
+// client returns the s3 client of the profile for the region, the region of the profile if region is empty.
+func (b *BucketBasics) client(profile, region string) (*s3.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.clients[clientKey{profile, region}]; ok {
+		return c, nil
+	}
+	if _, ok := b.configs[profile]; !ok {
+		if err := b.AddClient(profile, b.settings[profile]); err != nil {
+			return nil, err
+		}
+	}
+	p := b.settings[profile]
+	c := s3.NewFromConfig(b.configs[profile], func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+		if p == nil {
+			return
+		}
+		if p.Endpoint != "" {
+			o.BaseEndpoint = aws.String(p.Endpoint)
+		}
+		o.UsePathStyle = p.PathStyle
+	})
+	b.clients[clientKey{profile, region}] = c
+	return c, nil
+}
 
-		deleteObjectsInput := &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
-			Delete: &types.Delete{
-				Objects: make([]types.ObjectIdentifier, 0, len(page.Contents)),
-			},
+// hasEndpoint reports whether the profile points to an S3 compatible server.
+func (b *BucketBasics) hasEndpoint(profile string) bool {
+	p := b.settings[profile]
+	return p != nil && p.Endpoint != ""
+}
+
+// BucketRegion returns the region of the bucket, asked with GetBucketLocation.
+// The region is read from the response of HeadBucket when the profile may not get the location.
+func (b *BucketBasics) BucketRegion(bucket, profile string) (string, error) {
+	client, err := b.client(profile, "")
+	if err != nil {
+		return "", err
+	}
+	if b.hasEndpoint(profile) {
+		// The S3 compatible servers have no regions, the region of the profile is used.
+		return client.Options().Region, nil
+	}
+	ctx := context.Background()
+	out, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		region, herr := manager.GetBucketRegion(ctx, client, bucket)
+		var notFound manager.BucketNotFound
+		if errors.As(herr, &notFound) {
+			return "", herr
 		}
-		for _, object := range page.Contents {
-			deleteObjectsInput.Delete.Objects = append(deleteObjectsInput.Delete.Objects, types.ObjectIdentifier{
-				Key: object.Key,
-			})
+		if herr != nil {
+			return "", err
 		}
-		_, err = b.Clients[profile].DeleteObjects(ctx, deleteObjectsInput)
-		if err != nil {
-			return err
+		return region, nil
+	}
+	switch region := string(out.LocationConstraint); region {
+	case "":
+		// The buckets of us-east-1 have no location constraint.
+		return "us-east-1", nil
+	case "EU":
+		return "eu-west-1", nil
+	default:
+		return region, nil
+	}
+}
+
+// Bucket returns the bucket of the profile as a storage backend. The region of the bucket is
+// detected if it is empty, a wrong region is corrected when the bucket redirects a request.
+// The objects are encrypted with enc, the default encryption of the bucket if it is nil.
+func (b *BucketBasics) Bucket(name, profile, region string, enc *s3yncconfig.Encryption) (*Bucket, error) {
+	sse, err := newSSE(enc)
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		if region, err = b.BucketRegion(name, profile); err != nil {
+			return nil, err
 		}
 	}
-	// Delete the directory itself (empty prefix)
-	_, err := b.Clients[profile].DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	return err
+	client, err := b.client(profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{basics: b, profile: profile, name: name, sse: sse, client: client}, nil
 }
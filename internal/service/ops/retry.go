@@ -0,0 +1,44 @@
+package ops
+
+import (
+	"strings"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+func init() {
+	storage.RegisterTransient(IsTransient)
+}
+
+// transientErrorCodes are the error codes of the bucket, other than the ones retried by the sdk,
+// of operations that may succeed when they are tried again later.
+var transientErrorCodes = map[string]struct{}{
+	"ExpiredToken":          {},
+	"ExpiredTokenException": {},
+	"RequestExpired":        {},
+	"TokenRefreshRequired":  {},
+	"RequestTimeTooSkewed":  {},
+	"InternalError":         {},
+	"ServiceUnavailable":    {},
+}
+
+// transient checks the network errors, 5xx responses and throttling errors retried by the sdk,
+// then the error codes above and the credentials that couldn't be refreshed.
+var transient = retry.IsErrorRetryables(append(append([]retry.IsErrorRetryable{}, retry.DefaultRetryables...),
+	retry.RetryableHTTPStatusCode{Codes: map[int]struct{}{429: {}}},
+	retry.RetryableErrorCode{Codes: transientErrorCodes},
+	retry.IsErrorRetryableFunc(func(err error) aws.Ternary {
+		if strings.Contains(err.Error(), "failed to refresh cached credentials") {
+			return aws.TrueTernary
+		}
+		return aws.UnknownTernary
+	}),
+))
+
+// IsTransient reports whether a failed operation may succeed when it is tried again:
+// network errors, 5xx responses, throttling and expired credentials.
+func IsTransient(err error) bool {
+	return err != nil && transient.IsErrorRetryable(err).Bool()
+}
@@ -0,0 +1,148 @@
+// Package queue runs the operations of the syncs with a bounded number of workers.
+// Every sync has its own FIFO of jobs, the workers take the jobs of the syncs in turn
+// so a sync with many jobs does not starve the others, and a sync never runs more
+// jobs at once than its limit.
+package queue
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by Push after the queue is closed.
+var ErrClosed = errors.New("queue is closed")
+
+// Queue is a bounded job queue served by a fixed number of workers.
+type Queue struct {
+	mu       sync.Mutex
+	ready    *sync.Cond          // signaled when a job is pushed, a job finishes or the queue is closed
+	notFull  *sync.Cond          // signaled when a job is taken or the queue is closed
+	pending  map[string][]func() // Key: root path of the sync
+	order    []string            // syncs with pending jobs, in the order they are served
+	running  map[string]int
+	limits   map[string]int
+	depth    int
+	capacity int
+	closed   bool
+	workers  sync.WaitGroup
+}
+
+// New starts the workers of a queue that holds at most capacity pending jobs.
+func New(workers, capacity int) *Queue {
+	q := &Queue{
+		pending:  make(map[string][]func()),
+		running:  make(map[string]int),
+		limits:   make(map[string]int),
+		capacity: capacity,
+	}
+	q.ready = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// SetLimit limits the number of jobs of the sync running at once. Zero means no limit other than the workers.
+func (q *Queue) SetLimit(sync string, limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit <= 0 {
+		delete(q.limits, sync)
+	} else {
+		q.limits[sync] = limit
+	}
+	q.ready.Broadcast()
+}
+
+// Push adds a job of the sync to the queue. It blocks while the queue is full,
+// so the producers slow down to the pace of the workers.
+func (q *Queue) Push(sync string, job func()) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.depth >= q.capacity && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrClosed
+	}
+	if len(q.pending[sync]) == 0 {
+		q.order = append(q.order, sync)
+	}
+	q.pending[sync] = append(q.pending[sync], job)
+	q.depth++
+	q.ready.Signal()
+	return nil
+}
+
+// Depth returns the number of pending jobs.
+func (q *Queue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth
+}
+
+// Close stops the workers after the running jobs finish and returns the number of pending jobs dropped.
+func (q *Queue) Close() int {
+	q.mu.Lock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	q.workers.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped := q.depth
+	q.pending = make(map[string][]func())
+	q.order = nil
+	q.depth = 0
+	return dropped
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		sync, job, ok := q.next()
+		if !ok {
+			return
+		}
+		job()
+		q.mu.Lock()
+		q.running[sync]--
+		q.ready.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// next waits for a job of a sync under its limit. It returns false when the queue is closed.
+func (q *Queue) next() (string, func(), bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return "", nil, false
+		}
+		for i, sync := range q.order {
+			if limit, ok := q.limits[sync]; ok && q.running[sync] >= limit {
+				continue
+			}
+			job := q.pending[sync][0]
+			q.pending[sync] = q.pending[sync][1:]
+			// The sync goes to the end of the line, or leaves it if it has no more jobs.
+			q.order = append(q.order[:i:i], q.order[i+1:]...)
+			if len(q.pending[sync]) != 0 {
+				q.order = append(q.order, sync)
+			} else {
+				delete(q.pending, sync)
+			}
+			q.running[sync]++
+			q.depth--
+			q.notFull.Signal()
+			return sync, job, true
+		}
+		q.ready.Wait()
+	}
+}
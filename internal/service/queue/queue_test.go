@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// block pushes a job of the sync that runs until release is closed and waits for a worker to take it.
+func block(t *testing.T, q *Queue, sync string, release <-chan struct{}) {
+	t.Helper()
+	started := make(chan struct{})
+	if err := q.Push(sync, func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the blocking job is not taken by a worker")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	q := New(4, 100)
+	defer q.Close()
+	q.SetLimit("a", 1)
+
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		err := q.Push("a", func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("the sync ran %d jobs at once, want 1", peak)
+	}
+}
+
+func TestLimitDoesNotBlockOtherSyncs(t *testing.T) {
+	q := New(2, 100)
+	release := make(chan struct{})
+	defer q.Close()
+	defer close(release)
+	q.SetLimit("a", 1)
+	block(t, q, "a", release)
+
+	// The second job of a waits for the first, b runs on the free worker.
+	if err := q.Push("a", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	if err := q.Push("b", func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the job of b waits for the limit of a")
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	q := New(1, 1)
+	release := make(chan struct{})
+	block(t, q, "a", release)
+	if err := q.Push("a", func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.Push("a", func() {})
+	}()
+	select {
+	case err := <-pushed:
+		t.Fatalf("Push returned %v while the queue is full, want it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-pushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Push still blocks after the workers took the pending jobs")
+	}
+	q.Close()
+}
+
+func TestFairness(t *testing.T) {
+	q := New(1, 100)
+	release := make(chan struct{})
+	block(t, q, "x", release)
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	push := func(sync string) {
+		wg.Add(1)
+		err := q.Push(sync, func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, sync)
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a queues all its jobs before b, the worker still takes them in turn.
+	for i := 0; i < 3; i++ {
+		push("a")
+	}
+	for i := 0; i < 3; i++ {
+		push("b")
+	}
+	close(release)
+	wg.Wait()
+	q.Close()
+
+	want := []string{"a", "b", "a", "b", "a", "b"}
+	if len(order) != len(want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got %v, want %v", order, want)
+		}
+	}
+}
+
+func TestCloseUnblocksPush(t *testing.T) {
+	q := New(1, 1)
+	release := make(chan struct{})
+	block(t, q, "a", release)
+	if err := q.Push("a", func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.Push("a", func() {})
+	}()
+	closed := make(chan int)
+	go func() {
+		closed <- q.Close()
+	}()
+
+	// Close waits for the running job, the blocked Push returns before it finishes.
+	select {
+	case err := <-pushed:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Push returned %v, want ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Push still blocks after the queue is closed")
+	}
+
+	close(release)
+	select {
+	case dropped := <-closed:
+		if dropped != 1 {
+			t.Errorf("Close dropped %d jobs, want 1", dropped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close does not return after the running job finishes")
+	}
+	if err := q.Push("a", func() {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Push after Close returned %v, want ErrClosed", err)
+	}
+}
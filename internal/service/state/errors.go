@@ -0,0 +1,13 @@
+package state
+
+import "fmt"
+
+// StoreFailedError represents an error when trying to open the state database.
+type StoreFailedError struct {
+	Err error
+}
+
+// Allow StoreFailedError to satisfy error interface.
+func (e *StoreFailedError) Error() string {
+	return fmt.Sprintf("Failed to open the state database: %q", e.Err)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package state
+
+import "os"
+
+// Inode returns zero, the file info has no file index on windows.
+// Renamed files are matched by their size, mtime and content instead.
+func Inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// retriesBucket is the bolt bucket of the retry queue.
+// The buckets of the syncs are named after absolute paths, a sync can not have this name.
+const retriesBucket = "retries"
+
+// Operations of the retry queue.
+const (
+	OpUpload = "upload"
+	// OpDelete applies the delete policy of the sync to the removed path.
+	OpDelete = "delete"
+)
+
+// Retry is an operation that still failed after its retries and waits to be tried again.
+type Retry struct {
+	Local string `json:"local"` // root path of the sync
+	Key   string `json:"key"`   // path of the file relative to the root of the sync
+	Path  string `json:"path"`  // local path of the file
+	Op    string `json:"op"`
+	Error string `json:"error"`
+	// Attempts is the number of times the operation was moved to the retry queue.
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// retryKey is the key of the operation in the retry queue, a path has one operation at most.
+func retryKey(root, key string) []byte {
+	return []byte(root + "\x00" + key)
+}
+
+// PutRetry adds the failed operation to the retry queue. It replaces the operation of the same path.
+func (s *Store) PutRetry(r *Retry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(retriesBucket))
+		if err != nil {
+			return err
+		}
+		k := retryKey(r.Local, r.Key)
+		r.Attempts = 1
+		if v := b.Get(k); v != nil {
+			var old Retry
+			if err := json.Unmarshal(v, &old); err == nil {
+				r.Attempts = old.Attempts + 1
+			}
+		}
+		v, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(k, v)
+	})
+}
+
+// DeleteRetry removes the operation of the file of the sync from the retry queue.
+func (s *Store) DeleteRetry(root, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(retriesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(retryKey(root, key))
+	})
+}
+
+// Retries returns the operations of the retry queue, ordered by sync and path.
+func (s *Store) Retries() ([]*Retry, error) {
+	var retries []*Retry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(retriesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			r := &Retry{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			retries = append(retries, r)
+			return nil
+		})
+	})
+	return retries, err
+}
+
+// deleteRetries removes the operations of the sync from the retry queue.
+func deleteRetries(tx *bolt.Tx, root string) error {
+	b := tx.Bucket([]byte(retriesBucket))
+	if b == nil {
+		return nil
+	}
+	prefix := retryKey(root, "")
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package state is the local database of the files synced by the service.
+// Every sync has its own bolt bucket, keyed by the path of the file relative to the root of the sync.
+package state
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Results of the last sync of a file.
+const (
+	ResultOK = "ok"
+	// ResultPending is recorded before an upload starts. A file that is still pending
+	// when the service starts was being uploaded when the service crashed.
+	ResultPending = "pending"
+)
+
+// File is the state of a synced file.
+type File struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// Hash is the hex MD5 of the content, it equals the ETag of an object uploaded in a single part.
+	Hash     string    `json:"hash"`
+	Inode    uint64    `json:"inode,omitempty"` // zero where the inode is not known
+	Key      string    `json:"key"`
+	ETag     string    `json:"etag"`
+	Result   string    `json:"result"` // ResultOK, ResultPending or the error of the last sync
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// IsSynced reports whether the file was synced successfully when it had the size and mtime.
+func (f *File) IsSynced(size int64, modTime time.Time) bool {
+	return f != nil && f.Result == ResultOK && f.Size == size && f.ModTime.Equal(modTime)
+}
+
+// Store is the state database.
+type Store struct {
+	db *bolt.DB
+}
+
+// StoreFile returns the path of the state database.
+func StoreFile() string {
+	return filepath.Join(config.ConfigDir(), "state.db")
+}
+
+// Open opens the state database, it is created if it does not exist.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, &StoreFailedError{Err: err}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the state database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the state of the file of the sync, or nil if the file was never synced.
+func (s *Store) Get(root, path string) (*File, error) {
+	var f *File
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(root))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		f = &File{}
+		return json.Unmarshal(v, f)
+	})
+	return f, err
+}
+
+// Put records the state of the file of the sync.
+func (s *Store) Put(root, path string, f *File) error {
+	v, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(root))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(path), v)
+	})
+}
+
+// Delete removes the state of the file of the sync, and of every file under it if it is a directory.
+func (s *Store) Delete(root, path string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(root))
+		if b == nil {
+			return nil
+		}
+		// Keys are collected first, deleting while iterating skips keys.
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(path)); k != nil && strings.HasPrefix(string(k), path); k, _ = c.Next() {
+			if p := string(k); p == path || path == "" || strings.HasPrefix(p, path+"/") {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// All returns the state of every file of the sync. Key: path relative to the root of the sync
+func (s *Store) All(root string) (map[string]*File, error) {
+	files := make(map[string]*File)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(root))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			f := &File{}
+			if err := json.Unmarshal(v, f); err != nil {
+				return err
+			}
+			files[string(k)] = f
+			return nil
+		})
+	})
+	return files, err
+}
+
+// Under returns the state of the file of the sync and of every file under it if it is a directory.
+// Key: path relative to the root of the sync
+func (s *Store) Under(root, path string) (map[string]*File, error) {
+	files := make(map[string]*File)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(root))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(path)); k != nil && strings.HasPrefix(string(k), path); k, v = c.Next() {
+			if p := string(k); p != path && path != "" && !strings.HasPrefix(p, path+"/") {
+				continue
+			}
+			f := &File{}
+			if err := json.Unmarshal(v, f); err != nil {
+				return err
+			}
+			files[string(k)] = f
+		}
+		return nil
+	})
+	return files, err
+}
+
+// DeleteSync removes the state of every file of the sync and its operations in the retry queue.
+func (s *Store) DeleteSync(root string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(root)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return deleteRetries(tx, root)
+	})
+}
+
+// DeleteSyncFile removes the state of the sync whose root is root from the state database of the file,
+// for the commands that add or remove a sync while the service is not running.
+func DeleteSyncFile(path, root string) error {
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.DeleteSync(root)
+}
+
+// Hash returns the hex MD5 of the content of the file.
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	transientMu     sync.RWMutex
+	transientChecks []func(error) bool
+)
+
+// RegisterTransient adds the check of the errors of a backend that may succeed when the operation is tried again.
+// It is called by the backend packages when they are initialized.
+func RegisterTransient(check func(error) bool) {
+	transientMu.Lock()
+	defer transientMu.Unlock()
+	transientChecks = append(transientChecks, check)
+}
+
+// IsTransient reports whether a failed operation may succeed when it is tried again,
+// as checked by the registered backends: network errors, 5xx responses, throttling and expired credentials.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	transientMu.RLock()
+	defer transientMu.RUnlock()
+	for _, check := range transientChecks {
+		if check(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff is the policy of the retries of the operations that fail with a transient error.
+type Backoff struct {
+	Attempts int           // attempts of the operation, including the first one
+	Base     time.Duration // maximum wait before the first retry, it doubles at every retry
+	Max      time.Duration // maximum wait between two attempts
+}
+
+// Retry runs op until it succeeds, fails with an error that is not transient or runs out of attempts,
+// and returns its last error. The waits between the attempts are jittered, so the operations
+// throttled together are not tried again together. Retry gives up when stop is closed.
+func (b Backoff) Retry(stop <-chan struct{}, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !IsTransient(err) || attempt >= b.Attempts {
+			return err
+		}
+		select {
+		case <-time.After(b.delay(attempt)):
+		case <-stop:
+			return err
+		}
+	}
+}
+
+// delay returns a random wait before the retry following the attempt.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Max
+	if attempt < 32 {
+		if e := b.Base << (attempt - 1); e > 0 && e < b.Max {
+			d = e
+		}
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
@@ -0,0 +1,168 @@
+// Package storage is the interface of the storage services the syncs are mirrored to,
+// and the operations of the service built on it. Every service is a Backend implementation,
+// the sync selects its backend in the config file.
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+)
+
+// ErrNotFound is returned by Get and Head when there is no object with the key.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo is the metadata of an object.
+type ObjectInfo struct {
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
+// Backend is a bucket, or whatever its service calls it, that a sync is mirrored to.
+// Keys are slash separated paths relative to the root of the sync.
+type Backend interface {
+	// Put stores the content of r, whose size is size, in the object of the key and returns the ETag of the object.
+	// r is an io.ReaderAt and io.Seeker when the content is a file, so large files are read in parts.
+	Put(key string, r io.Reader, size int64, opts UploadOptions) (string, error)
+	// Get returns the content of the object of the key.
+	Get(key string) (io.ReadCloser, error)
+	// Head returns the metadata of the object of the key.
+	Head(key string) (*ObjectInfo, error)
+	// List returns the metadata of every object whose key starts with prefix. Key: object key
+	List(prefix string) (map[string]ObjectInfo, error)
+	// Delete deletes the objects of the keys, a missing object is not an error.
+	Delete(keys []string) error
+	// Copy copies the object of the key src, whose size is size, to the key dst without downloading it.
+	// It returns the ETag of the copy.
+	Copy(src, dst string, size int64) (string, error)
+	// ETagIsMD5 reports whether the ETags of the objects uploaded in a single part are the hex MD5 of their content,
+	// so an object is compared with a local file by the hash of the file.
+	ETagIsMD5() bool
+}
+
+// PutFile streams the file into the object of the key and returns the ETag of the object.
+func PutFile(b Backend, key, fileName string, opts UploadOptions) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	return b.Put(key, newProgressReader(file, info.Size(), opts.Progress), info.Size(), opts)
+}
+
+// SyncFile uploads the file of the sync whose root is root, unless the state shows
+// that the same content is already uploaded. The result of the upload is recorded in the state.
+// It reports whether the upload is skipped.
+func SyncFile(b Backend, store *state.Store, root, objectKey, fileName string, opts UploadOptions) (bool, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return false, err
+	}
+	f, err := store.Get(root, objectKey)
+	if err != nil {
+		return false, err
+	}
+	if f.IsSynced(info.Size(), info.ModTime()) {
+		return true, nil
+	}
+	hash, err := state.Hash(fileName)
+	if err != nil {
+		return false, err
+	}
+	if f != nil && f.Result == state.ResultOK && f.Size == info.Size() && f.Hash == hash {
+		// The file is touched, its content is the same.
+		f.ModTime = info.ModTime()
+		return true, store.Put(root, objectKey, f)
+	}
+
+	f = &state.File{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+		Inode:   state.Inode(info),
+		Key:     objectKey,
+		Result:  state.ResultPending,
+	}
+	if err := store.Put(root, objectKey, f); err != nil {
+		return false, err
+	}
+	f.ETag, err = PutFile(b, objectKey, fileName, opts)
+	f.SyncedAt = time.Now()
+	f.Result = state.ResultOK
+	if err != nil {
+		f.Result = err.Error()
+	}
+	if perr := store.Put(root, objectKey, f); err == nil {
+		err = perr
+	}
+	return false, err
+}
+
+// DeleteSynced deletes the objects uploaded by the sync whose root is root for the file of the key,
+// and for every file under it if the key is a directory. The other objects under the key are not the sync's, they are kept.
+// The empty key is the root of the sync. It returns the keys of the objects.
+func DeleteSynced(b Backend, store *state.Store, root, key string) ([]string, error) {
+	keys, err := SyncedKeys(store, root, key)
+	if err != nil || len(keys) == 0 {
+		return keys, err
+	}
+	return keys, b.Delete(keys)
+}
+
+// ArchiveSynced moves the objects uploaded by the sync whose root is root for the file of the key,
+// and for every file under it if the key is a directory, to the trash prefix.
+// ex. dir/file1.txt is moved to .s3ync-trash/dir/file1.txt
+func ArchiveSynced(b Backend, store *state.Store, root, key, trashPrefix string) error {
+	keys, err := SyncedKeys(store, root, key)
+	if err != nil {
+		return err
+	}
+	for _, objectKey := range keys {
+		if strings.HasPrefix(objectKey, trashPrefix) {
+			continue
+		}
+		object, err := b.Head(objectKey)
+		if errors.Is(err, ErrNotFound) {
+			// The object is already deleted, ex. from the console.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := b.Copy(objectKey, trashPrefix+objectKey, object.Size); err != nil {
+			return err
+		}
+		if err := b.Delete([]string{objectKey}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncedKeys returns the sorted keys of the objects uploaded by the sync whose root is root
+// for the file of the key and every file under it.
+func SyncedKeys(store *state.Store, root, key string) ([]string, error) {
+	files, err := store.Under(root, key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(files))
+	for path, f := range files {
+		if f.Key == "" {
+			f.Key = path
+		}
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
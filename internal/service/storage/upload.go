@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// UploadOptions tunes the multipart uploads of a sync.
+type UploadOptions struct {
+	// PartSize is the size of each part in bytes, the default of the backend if zero.
+	// A file is uploaded in a single request if it is not larger than a part.
+	PartSize int64
+	// Concurrency is the number of parts of a file uploaded in parallel, the default of the backend if zero.
+	Concurrency int
+	// Progress, if not nil, is called with the bytes of the file read for the upload so far.
+	Progress func(sent, total int64)
+}
+
+// progressReader reports the bytes of a file read by the backend.
+// It keeps io.ReaderAt and io.Seeker, so the backends read the parts from the file instead of buffering them.
+type progressReader struct {
+	file     *os.File
+	total    int64
+	sent     atomic.Int64
+	progress func(sent, total int64)
+}
+
+func newProgressReader(file *os.File, total int64, progress func(sent, total int64)) io.Reader {
+	if progress == nil {
+		return file
+	}
+	return &progressReader{file: file, total: total, progress: progress}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.report(n)
+	return n, err
+}
+
+func (r *progressReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.file.ReadAt(p, off)
+	r.report(n)
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	return r.file.Seek(offset, whence)
+}
+
+func (r *progressReader) report(n int) {
+	// A part read again for a retry is counted again, the progress never exceeds the total.
+	sent := r.sent.Add(int64(n))
+	if sent > r.total {
+		sent = r.total
+	}
+	r.progress(sent, r.total)
+}
@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// Watcher is the control.Handler of the service.
+var _ control.Handler = (*Watcher)(nil)
+
+// AddSync reloads the config file, so the sync whose root is local is watched and uploaded.
+// The state left under the root by an older sync is removed before the sync is reconciled.
+func (w *Watcher) AddSync(local string) error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+	syncsMu.RLock()
+	defer syncsMu.RUnlock()
+	if _, ok := syncs.All[local]; !ok {
+		return fmt.Errorf("%s is not in the config file", local)
+	}
+	return nil
+}
+
+// RemoveSync reloads the config file, so every watch under the root of the sync is removed.
+func (w *Watcher) RemoveSync(local string) error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+	syncsMu.RLock()
+	defer syncsMu.RUnlock()
+	if _, ok := syncs.All[local]; ok {
+		return fmt.Errorf("%s is still in the config file", local)
+	}
+	return nil
+}
+
+// SyncedKeys returns the keys of the objects uploaded by the sync whose root is local, they are read from the state.
+func (w *Watcher) SyncedKeys(local string) ([]string, error) {
+	return storage.SyncedKeys(store, local, "")
+}
+
+// Status returns the configured syncs of the service with their pending operations and the recent errors.
+func (w *Watcher) Status() *control.Status {
+	watches := w.WatchList()
+	failed := make(map[string]int)
+	if retries, err := store.Retries(); err == nil {
+		for _, r := range retries {
+			failed[r.Local]++
+		}
+	}
+
+	syncsMu.RLock()
+	defer syncsMu.RUnlock()
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	status := &control.Status{StartedAt: startedAt, Workers: workers, QueueDepth: jobs.Depth()}
+	for root, s := range syncs.All {
+		ss := control.SyncStatus{
+			Local:   root,
+			Profile: s.Profile,
+			Bucket:  s.Bucket,
+			Paused:  paused[s.Profile],
+			Delete:  s.Delete,
+			Failed:  failed[root],
+		}
+		l := filepath.ToSlash(localPath(root))
+		for _, watch := range watches {
+			if p := filepath.ToSlash(watch); p == l || strings.HasPrefix(p, l+"/") {
+				ss.Watches++
+			}
+		}
+		if st, ok := stats[root]; ok {
+			ss.QueuedUploads, ss.InflightUploads = st.queued[opUpload], st.inflight[opUpload]
+			ss.QueuedDeletes, ss.InflightDeletes = st.queued[opDelete], st.inflight[opDelete]
+			ss.Reconciled = st.reconciled
+			ss.Unstable = append(ss.Unstable, st.unstable...)
+			for _, u := range st.uploads {
+				ss.Uploads = append(ss.Uploads, *u)
+			}
+			sort.Slice(ss.Uploads, func(i, j int) bool { return ss.Uploads[i].Path < ss.Uploads[j].Path })
+			if !st.lastSync.IsZero() {
+				lastSync := st.lastSync
+				ss.LastSync = &lastSync
+			}
+		}
+		status.Syncs = append(status.Syncs, ss)
+	}
+	status.RecentErrors = append(status.RecentErrors, recentErrors...)
+	sort.Slice(status.Syncs, func(i, j int) bool { return status.Syncs[i].Local < status.Syncs[j].Local })
+	return status
+}
+
+// Pause removes the watches of the syncs of the profile, or of all profiles if profile is empty.
+// Events of the suspended syncs are ignored until they are resumed.
+func (w *Watcher) Pause(profile string) error {
+	for _, root := range setPaused(profile, true) {
+		send(rmPath, root)
+	}
+	return nil
+}
+
+// Resume watches the suspended syncs of the profile, or of all profiles if profile is empty,
+// and uploads their contents.
+func (w *Watcher) Resume(profile string) error {
+	for _, root := range setPaused(profile, false) {
+		send(addPath, root)
+	}
+	return nil
+}
+
+// setPaused suspends or resumes the profile and returns the roots of its syncs whose state is changed.
+func setPaused(profile string, p bool) []string {
+	syncsMu.Lock()
+	defer syncsMu.Unlock()
+	var roots []string
+	for root, s := range syncs.All {
+		if (profile == "" || s.Profile == profile) && paused[s.Profile] != p {
+			roots = append(roots, root)
+		}
+	}
+	if profile != "" {
+		paused[profile] = p
+		return roots
+	}
+	for _, s := range syncs.All {
+		paused[s.Profile] = p
+	}
+	return roots
+}
@@ -0,0 +1,176 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+)
+
+// maxDebounce is the longest a path is delayed, in debounce windows. A file written
+// continuously, like a log, is still synced while it is being written.
+const maxDebounce = 10
+
+// pendingPath is a path whose events are waiting for the end of its debounce window.
+type pendingPath struct {
+	timer *time.Timer
+	first time.Time // time of the first event of the window
+	// created is true if the first event created the path. A path created and removed
+	// in the same window is never sent to the bucket.
+	created bool
+	// observed is true after the stability check saw the file, with its size and mtime.
+	observed bool
+	size     int64
+	modTime  time.Time
+}
+
+var (
+	pendingMu sync.Mutex
+	pending   = make(map[string]*pendingPath) // Key: local path
+)
+
+// debounce delays the sync of the path until it receives no event for the debounce window of its sync.
+// The events of the window are merged, the operation sent to the bucket depends only on the path
+// at the end of the window: an upload if it is a file, a delete if it is removed.
+func debounce(path string, s *config.Sync, created bool) {
+	if s.Debounce <= 0 && s.Stable <= 0 {
+		flush(path, &pendingPath{created: created}, false)
+		return
+	}
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if p, ok := pending[path]; ok {
+		if time.Since(p.first)+s.Debounce > maxDebounce*s.Debounce {
+			// The window is not extended anymore, the path is synced when its timer fires.
+			return
+		}
+		if p.timer.Stop() {
+			p.timer.Reset(s.Debounce)
+			return
+		}
+		// The timer has fired already, its settle is waiting for the lock and leaves the path to a new window.
+		created = p.created
+	}
+	p := &pendingPath{first: time.Now(), created: created}
+	p.timer = time.AfterFunc(s.Debounce, func() { settle(path, p) })
+	pending[path] = p
+}
+
+// cancelPending drops the events of the path and of the paths under it waiting for their debounce window.
+func cancelPending(path string) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	prefix := strings.TrimSuffix(filepath.ToSlash(path), "/") + "/"
+	for p, pp := range pending {
+		if p == path || strings.HasPrefix(filepath.ToSlash(p), prefix) {
+			pp.timer.Stop()
+			delete(pending, p)
+		}
+	}
+}
+
+// flushPending queues the operations of the paths waiting for the end of their debounce window,
+// the service is stopping and their timers would fire after the queue is closed.
+func flushPending() {
+	pendingMu.Lock()
+	paths := pending
+	pending = make(map[string]*pendingPath)
+	pendingMu.Unlock()
+	for path, p := range paths {
+		// A timer that has fired already finds its path is not pending anymore and leaves it.
+		p.timer.Stop()
+		flush(path, p, false)
+	}
+}
+
+// settle runs at the end of the debounce window of the path. A file is synced once its size
+// and mtime do not change for the stability period of its sync, the timer is armed again until then.
+func settle(path string, p *pendingPath) {
+	_, s, ok := getSync(path)
+	stable := true
+	if ok && s.Stable > 0 {
+		// Only settle changes the observation, the timer of p is not running.
+		if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+			stable = p.observed && info.Size() == p.size && info.ModTime().Equal(p.modTime)
+			if stable && s.StableCheckOpen {
+				if open, err := isOpenForWrite(path); err == nil && open {
+					stable = false
+				}
+			}
+			p.observed, p.size, p.modTime = true, info.Size(), info.ModTime()
+		}
+	}
+
+	pendingMu.Lock()
+	if pending[path] != p {
+		pendingMu.Unlock()
+		return
+	}
+	if !stable && time.Since(p.first) < s.StableMaxWait {
+		p.timer.Reset(s.Stable)
+		pendingMu.Unlock()
+		return
+	}
+	delete(pending, path)
+	pendingMu.Unlock()
+	flush(path, p, !stable)
+}
+
+// flush queues the net operation of the events of the path.
+// unstable is true if the file is uploaded while it is still changing.
+func flush(path string, p *pendingPath, unstable bool) {
+	root, s, ok := getSync(path)
+	if !ok {
+		return
+	}
+	key := relativePath(root, path)
+
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.IsDir():
+		// Directories are uploaded by their Create event, with the files in them.
+		return
+	case err == nil:
+		if unstable {
+			fmt.Printf("Uploading %q while it is still changing after %v\n", path, s.StableMaxWait)
+			flagUnstable(root, path)
+		}
+		enqueue(root, opUpload, func() {
+			upload(root, s, key, path)
+		})
+	default:
+		if p.created {
+			if f, err := store.Get(root, key); err == nil && f == nil {
+				// The path is created and removed in the window, the bucket never had it.
+				return
+			}
+		}
+		enqueue(root, opDelete, func() {
+			if err := remove(root, s, key, path); err != nil {
+				fmt.Printf("Couldn't delete %v from %v:%v. Here's why: %v\n", path, s.Bucket, key, err)
+			}
+		})
+	}
+}
+
+// uploadSettled returns the job of an upload found by a walk of the sync. A file modified during
+// the stability period of the sync may still be being written, it goes through the stability check instead.
+func uploadSettled(root string, s *config.Sync, key, path string) func() {
+	return func() {
+		if info, err := os.Stat(path); err == nil && s.Stable > 0 && time.Since(info.ModTime()) < s.Stable {
+			unqueued(root, opUpload)
+			debounce(path, s, false)
+			return
+		}
+		upload(root, s, key, path)
+	}
+}
+
+// relativePath returns the path relative to the root of its sync, which is the key of its object.
+func relativePath(root, path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(localPath(root))), "/")
+}
@@ -0,0 +1,152 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// ReconcileAll compares every active sync with its bucket and queues the work
+// missed while the service was not running.
+func (w *Watcher) ReconcileAll() {
+	syncsMu.RLock()
+	roots := make(map[string]*config.Sync)
+	for root, s := range syncs.All {
+		if !paused[s.Profile] {
+			roots[root] = s
+		}
+	}
+	syncsMu.RUnlock()
+
+	for root, s := range roots {
+		// Remote objects are deleted or archived according to the delete policy of the sync.
+		if err := reconcile(root, s, s.Delete); err != nil {
+			fmt.Printf("Couldn't reconcile %v with %v. Here's why: %v\n", root, s.Bucket, err)
+		}
+	}
+}
+
+// reconcile uploads the files of the sync that are missing or changed in the bucket.
+// The objects of the synced files that do not exist anymore are deleted, archived or kept according to the policy.
+func reconcile(root string, s *config.Sync, policy string) error {
+	b, err := backends.Get(s)
+	if err != nil {
+		return err
+	}
+	// The objects are listed to compare them with the files.
+	objects, err := b.List("")
+	if err != nil {
+		return err
+	}
+	files, err := store.All(root)
+	if err != nil {
+		return err
+	}
+
+	summary := control.ReconcileSummary{Time: time.Now()}
+	dir := localPath(root)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if skip, err := skipIgnored(path, info); skip {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		objectKey := strings.TrimPrefix(strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(dir)), "/")
+		if strings.HasPrefix(objectKey, s.TrashPrefix) {
+			// The trash of the bucket is not synced.
+			return nil
+		}
+		object, ok := objects[objectKey]
+		file := files[objectKey]
+		delete(objects, objectKey)
+		delete(files, objectKey)
+		if ok && isUnchanged(path, info, object, file, b.ETagIsMD5()) {
+			summary.Unchanged++
+			return nil
+		}
+		summary.Uploads++
+		enqueue(root, opUpload, uploadSettled(root, s, objectKey, path))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The remaining files were synced before, they are removed locally or the walk did not reach them.
+	// Only their objects are deleted or archived, the objects the sync did not upload are never touched.
+	for objectKey := range files {
+		path := filepath.Join(dir, filepath.FromSlash(objectKey))
+		_, err := os.Lstat(path)
+		_, ok := objects[objectKey]
+		switch {
+		case ignored(root, path, false):
+			// The objects of the ignored files are left in the bucket.
+		case !errors.Is(err, fs.ErrNotExist):
+			// The file is not removed, ex. its directory is not readable, it is synced by its next event.
+			continue
+		case ok && policy != config.DeleteKeep:
+			summary.Deletes++
+			objectKey := objectKey
+			enqueue(root, opDelete, func() {
+				if policy == config.DeleteArchive {
+					archiveDirectory(root, s, objectKey, path)
+					return
+				}
+				deleteDirectory(root, s, objectKey, path)
+			})
+			continue
+		}
+		if err := store.Delete(root, objectKey); err != nil {
+			return err
+		}
+	}
+
+	reconciled(root, summary)
+	fmt.Printf("Reconciled %q with %v: %v uploads, %v deletes, %v unchanged\n",
+		root, s.Bucket, summary.Uploads, summary.Deletes, summary.Unchanged)
+	return nil
+}
+
+// isUnchanged compares a local file with its object by size, mtime and ETag.
+// The state of the file, if any, saves hashing the content. etagIsMD5 is false when the ETags
+// of the objects are not the MD5 of their content, ex. the objects encrypted with a KMS key or on the client,
+// or the blobs of Azure.
+func isUnchanged(path string, info os.FileInfo, object storage.ObjectInfo, file *state.File, etagIsMD5 bool) bool {
+	if info.Size() != object.Size {
+		return false
+	}
+	if file != nil {
+		// The service crashed while uploading the file.
+		if file.Result == state.ResultPending {
+			return false
+		}
+		if file.IsSynced(info.Size(), info.ModTime()) && file.ETag == object.ETag {
+			return true
+		}
+	}
+	// The object was uploaded after the last modification of the file.
+	if !info.ModTime().After(object.LastModified) {
+		return true
+	}
+	// The file is touched after the upload, its content may be the same.
+	// The ETag of an object uploaded in a single part is the MD5 of its content.
+	etag := strings.Trim(object.ETag, `"`)
+	if !etagIsMD5 || etag == "" || strings.Contains(etag, "-") {
+		return false
+	}
+	sum, err := state.Hash(path)
+	return err == nil && sum == etag
+}
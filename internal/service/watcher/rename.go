@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// renameWindow is the time a renamed path waits for the Create event of its new name.
+const renameWindow = time.Second
+
+// errMatched stops the walk of a new path once one of its files is matched to a renamed file.
+var errMatched = errors.New("matched")
+
+// renamed is a synced path renamed in a sync, waiting for its new name. The Rename event has
+// the old name only, the Create event of the new name follows it.
+type renamed struct {
+	root string
+	key  string // old object key
+	path string // old local path
+	// files is the state of the synced files of the old path.
+	// Key: path relative to the old path, empty for the path itself or starting with a slash
+	files map[string]*state.File
+	timer *time.Timer
+}
+
+var (
+	renamesMu sync.Mutex
+	renames   []*renamed
+)
+
+// rename keeps the renamed path of the sync for the rename window. If its new name is not created
+// in the window, the path is removed from the bucket like a deleted path.
+func rename(root string, s *config.Sync, path string) {
+	key := relativePath(root, path)
+	// The events of the old name waiting to be synced are replaced by the rename.
+	cancelPending(path)
+	files, err := store.Under(root, key)
+	if err != nil || len(files) == 0 || key == "" {
+		// Nothing is synced under the path, there is nothing to copy in the bucket.
+		debounce(path, s, false)
+		return
+	}
+	r := &renamed{root: root, key: key, path: path, files: make(map[string]*state.File)}
+	for k, f := range files {
+		if f.Result == state.ResultOK {
+			r.files[strings.TrimPrefix(k, key)] = f
+		}
+	}
+	renamesMu.Lock()
+	defer renamesMu.Unlock()
+	r.timer = time.AfterFunc(renameWindow, func() {
+		if take(r) {
+			debounce(path, s, false)
+		}
+	})
+	renames = append(renames, r)
+}
+
+// take removes the renamed path from the list, it reports false if it was taken already.
+func take(r *renamed) bool {
+	renamesMu.Lock()
+	defer renamesMu.Unlock()
+	for i, p := range renames {
+		if p == r {
+			renames = append(renames[:i], renames[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// matchRename returns the renamed path of the sync whose new name is path, and takes it from the list.
+// A renamed file is matched by its inode, or by its size, mtime and content where the inode is not known.
+// A renamed directory is matched by the first of its files.
+func matchRename(root, path string) *renamed {
+	renamesMu.Lock()
+	candidates := make([]*renamed, 0, len(renames))
+	for _, r := range renames {
+		if r.root == root {
+			candidates = append(candidates, r)
+		}
+	}
+	renamesMu.Unlock()
+
+	for _, r := range candidates {
+		matched := false
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			suffix := strings.TrimPrefix(filepath.ToSlash(p), filepath.ToSlash(path))
+			if f := r.files[suffix]; f != nil && sameFile(p, info, f) {
+				matched = true
+				return errMatched
+			}
+			return nil
+		})
+		if matched && take(r) {
+			r.timer.Stop()
+			return r
+		}
+	}
+	return nil
+}
+
+// sameFile reports whether the file is the synced file f under another name.
+func sameFile(path string, info os.FileInfo, f *state.File) bool {
+	if info.Size() != f.Size {
+		return false
+	}
+	if inode := state.Inode(info); inode != 0 && f.Inode != 0 {
+		return inode == f.Inode
+	}
+	if !info.ModTime().Equal(f.ModTime) {
+		return false
+	}
+	hash, err := state.Hash(path)
+	return err == nil && hash == f.Hash
+}
+
+// move copies the objects of the renamed path to its new name in the bucket, then applies the delete
+// policy of the sync to the old name. The files changed since they were synced are uploaded instead.
+func move(r *renamed, s *config.Sync, path string) error {
+	root := r.root
+	key := relativePath(root, path)
+	started(root, opUpload)
+	b, err := backends.Get(s)
+	if err != nil {
+		// The backend can't be opened, every operation of the sync fails the same way.
+		fmt.Printf("Couldn't move %v to %v in %v. Here's why: %v\n", r.path, path, s.Bucket, err)
+		finished(root, opUpload, path, err)
+		return err
+	}
+	var errs []error
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if skip, err := skipIgnored(p, info); skip {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		suffix := strings.TrimPrefix(filepath.ToSlash(p), filepath.ToSlash(path))
+		objectKey := key + suffix
+		f := r.files[suffix]
+		if f == nil || !sameFile(p, info, f) {
+			// The file is new or changed after it was synced.
+			err := try(root, opUpload, objectKey, p, func() error {
+				_, err := storage.SyncFile(b, store, root, objectKey, p, uploadOptions(root, s, p))
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+		err = try(root, opUpload, objectKey, p, func() error {
+			etag, err := b.Copy(r.key+suffix, objectKey, f.Size)
+			if err != nil {
+				return err
+			}
+			moved := *f
+			moved.Key, moved.ETag, moved.SyncedAt = objectKey, etag, time.Now()
+			return store.Put(root, objectKey, &moved)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+
+	// The files of the new name are uploaded or in the retry queue, the old name can be removed.
+	err = nil
+	switch s.Delete {
+	case config.DeleteMirror:
+		err = try(root, opDelete, r.key, r.path, func() error {
+			_, err := storage.DeleteSynced(b, store, root, r.key)
+			return err
+		})
+	case config.DeleteArchive:
+		err = try(root, opDelete, r.key, r.path, func() error {
+			return storage.ArchiveSynced(b, store, root, r.key, s.TrashPrefix)
+		})
+	}
+	if err == nil {
+		err = store.Delete(root, r.key)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		fmt.Printf("Couldn't move %v to %v in %v. Here's why: %v\n", r.path, path, s.Bucket, err)
+	}
+	finished(root, opUpload, path, err)
+	return err
+}
@@ -0,0 +1,131 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+var (
+	backoff       = storage.Backoff{Attempts: 5, Base: time.Second, Max: 30 * time.Second}
+	retryInterval time.Duration // interval between the automatic retries of the retry queue
+
+	retryingMu sync.Mutex
+	retrying   = make(map[string]bool) // operations of the retry queue waiting in the job queue. Key: root and path
+)
+
+// try runs the operation of the path with the retries of the backoff. If it still fails,
+// it is moved to the retry queue, otherwise the failed operation of the path is not needed anymore.
+func try(root string, o op, key, path string, fn func() error) error {
+	err := backoff.Retry(done, fn)
+	if root == "" {
+		return err
+	}
+	var serr error
+	if err != nil {
+		name := state.OpUpload
+		if o == opDelete {
+			name = state.OpDelete
+		}
+		serr = store.PutRetry(&state.Retry{
+			Local:    root,
+			Key:      key,
+			Path:     path,
+			Op:       name,
+			Error:    err.Error(),
+			FailedAt: time.Now(),
+		})
+	} else {
+		serr = store.DeleteRetry(root, key)
+	}
+	if serr != nil {
+		fmt.Printf("Couldn't update the retry queue of %v. Here's why: %v\n", path, serr)
+	}
+	return err
+}
+
+// Retry queues again the operations of the retry queue and returns their number.
+// The operations of the paused syncs stay in the retry queue.
+func (w *Watcher) Retry() (int, error) {
+	retries, err := store.Retries()
+	if err != nil {
+		return 0, err
+	}
+	type job struct {
+		r *state.Retry
+		o op
+		f func()
+	}
+	var pending []job
+	for _, r := range retries {
+		root, s, ok := getSync(r.Path)
+		if !ok || root != r.Local {
+			continue
+		}
+		r := r
+		switch r.Op {
+		case state.OpUpload:
+			if _, err := os.Stat(r.Path); err != nil {
+				// The file is removed after the upload failed, the remove event applied the delete policy.
+				store.DeleteRetry(r.Local, r.Key)
+				continue
+			}
+			pending = append(pending, job{r, opUpload, func() {
+				upload(r.Local, s, r.Key, r.Path)
+			}})
+		case state.OpDelete:
+			pending = append(pending, job{r, opDelete, func() {
+				remove(r.Local, s, r.Key, r.Path)
+			}})
+		}
+	}
+
+	// The jobs are pushed out of the control request, they wait while the queue is full.
+	go func() {
+		for _, j := range pending {
+			id := j.r.Local + "\x00" + j.r.Key
+			retryingMu.Lock()
+			if retrying[id] {
+				retryingMu.Unlock()
+				continue
+			}
+			retrying[id] = true
+			retryingMu.Unlock()
+
+			f := j.f
+			enqueue(j.r.Local, j.o, func() {
+				retryingMu.Lock()
+				delete(retrying, id)
+				retryingMu.Unlock()
+				f()
+			})
+		}
+	}()
+	return len(pending), nil
+}
+
+// RetryFailed queues again the operations of the retry queue at every retry interval until the watcher is stopped.
+func (w *Watcher) RetryFailed() {
+	if retryInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := w.Retry()
+			if err != nil {
+				fmt.Printf("Couldn't read the retry queue. Here's why: %v\n", err)
+			} else if n != 0 {
+				fmt.Printf("Retrying %v failed operations\n", n)
+			}
+		case <-done:
+			return
+		}
+	}
+}
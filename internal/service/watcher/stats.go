@@ -0,0 +1,242 @@
+package watcher
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
+)
+
+// maxRecentErrors is the number of failed operations kept for the status.
+const maxRecentErrors = 20
+
+// op is an operation sent to the bucket.
+type op int
+
+const (
+	opUpload op = iota
+	opDelete
+)
+
+// syncStats counts the operations of a sync.
+type syncStats struct {
+	queued   [2]int // indexed by op
+	inflight [2]int // indexed by op
+	lastSync time.Time
+	// reconciled is the result of the last comparison of the sync with its bucket.
+	reconciled *control.ReconcileSummary
+	// uploads is the progress of the in-flight uploads. Key: file path
+	uploads map[string]*control.UploadProgress
+	// unstable are the last files uploaded while they were still changing.
+	unstable []string
+}
+
+var (
+	statsMu      sync.Mutex
+	stats        = make(map[string]*syncStats) // Key: root path of the sync
+	recentErrors []control.ErrorStatus
+)
+
+func getStats(root string) *syncStats {
+	s, ok := stats[root]
+	if !ok {
+		s = &syncStats{uploads: make(map[string]*control.UploadProgress)}
+		stats[root] = s
+	}
+	return s
+}
+
+// queued records an operation of the sync that waits to be started.
+func queued(root string, o op) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	getStats(root).queued[o]++
+}
+
+// unqueued records an operation of the sync that is dropped before it is started.
+func unqueued(root string, o op) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	getStats(root).queued[o]--
+}
+
+// started records that a queued operation of the sync is sent to the bucket.
+func started(root string, o op) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s := getStats(root)
+	s.queued[o]--
+	s.inflight[o]++
+}
+
+// finished records the result of an operation of the sync on the path.
+func finished(root string, o op, path string, err error) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s := getStats(root)
+	s.inflight[o]--
+	if o == opUpload {
+		delete(s.uploads, path)
+	}
+	if err == nil {
+		s.lastSync = time.Now()
+		return
+	}
+	recentErrors = append(recentErrors, control.ErrorStatus{
+		Time:  time.Now(),
+		Local: root,
+		Path:  path,
+		Error: err.Error(),
+	})
+	if len(recentErrors) > maxRecentErrors {
+		recentErrors = recentErrors[len(recentErrors)-maxRecentErrors:]
+	}
+}
+
+// reconciled records the result of the comparison of the sync with its bucket.
+func reconciled(root string, summary control.ReconcileSummary) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	getStats(root).reconciled = &summary
+}
+
+// progress records the bytes of the in-flight upload of the file sent so far.
+func progress(root, path string, sent, total int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s := getStats(root)
+	u, ok := s.uploads[path]
+	if !ok {
+		u = &control.UploadProgress{Path: path}
+		s.uploads[path] = u
+	}
+	u.Sent, u.Total = sent, total
+}
+
+// flagUnstable records a file of the sync uploaded while it was still changing.
+func flagUnstable(root, path string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s := getStats(root)
+	s.unstable = append(s.unstable, path)
+	if len(s.unstable) > maxRecentErrors {
+		s.unstable = s.unstable[len(s.unstable)-maxRecentErrors:]
+	}
+}
+
+// enqueue queues an operation of the sync whose root is root and records it in the stats.
+// It blocks while the queue is full.
+func enqueue(root string, o op, job func()) {
+	queued(root, o)
+	if err := jobs.Push(root, job); err != nil {
+		// The service is stopping, the operation is synced by the reconciliation when it starts again.
+		unqueued(root, o)
+	}
+}
+
+// upload uploads the file to the bucket of the sync whose root is root, unless the state shows it is unchanged,
+// and records it in the stats of the sync.
+func upload(root string, s *config.Sync, objectKey, fileName string) error {
+	started(root, opUpload)
+	if !isActive(root) {
+		// The sync is removed or paused after the upload is queued.
+		finished(root, opUpload, fileName, nil)
+		return nil
+	}
+	opts := uploadOptions(root, s, fileName)
+	err := try(root, opUpload, objectKey, fileName, func() error {
+		b, err := backends.Get(s)
+		if err != nil {
+			return err
+		}
+		_, err = storage.SyncFile(b, store, root, objectKey, fileName, opts)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The file is removed before it is uploaded, its remove event applies the delete policy.
+			return nil
+		}
+		return err
+	})
+	finished(root, opUpload, fileName, err)
+	return err
+}
+
+// deleteDirectory deletes the objects the sync whose root is root uploaded for the path from its bucket
+// and records it in the stats of the sync.
+func deleteDirectory(root string, s *config.Sync, key, path string) error {
+	started(root, opDelete)
+	if !isActive(root) {
+		// The sync is removed or paused after the delete is queued.
+		finished(root, opDelete, path, nil)
+		return nil
+	}
+	err := try(root, opDelete, key, path, func() error {
+		b, err := backends.Get(s)
+		if err != nil {
+			return err
+		}
+		_, err = storage.DeleteSynced(b, store, root, key)
+		return err
+	})
+	if err == nil {
+		err = store.Delete(root, key)
+	}
+	finished(root, opDelete, path, err)
+	return err
+}
+
+// remove applies the delete policy of the sync whose root is root to the objects of the removed path.
+func remove(root string, s *config.Sync, key, path string) error {
+	switch s.Delete {
+	case config.DeleteMirror:
+		return deleteDirectory(root, s, key, path)
+	case config.DeleteArchive:
+		return archiveDirectory(root, s, key, path)
+	}
+	// The objects are kept, only the path is not synced anymore.
+	started(root, opDelete)
+	var err error
+	if isActive(root) {
+		err = store.Delete(root, key)
+	}
+	finished(root, opDelete, path, err)
+	return err
+}
+
+// archiveDirectory moves the objects the sync whose root is root uploaded for the path to the trash prefix
+// of its bucket and records it in the stats of the sync.
+func archiveDirectory(root string, s *config.Sync, key, path string) error {
+	started(root, opDelete)
+	if !isActive(root) {
+		// The sync is removed or paused after the delete is queued.
+		finished(root, opDelete, path, nil)
+		return nil
+	}
+	err := try(root, opDelete, key, path, func() error {
+		b, err := backends.Get(s)
+		if err != nil {
+			return err
+		}
+		return storage.ArchiveSynced(b, store, root, key, s.TrashPrefix)
+	})
+	if err == nil {
+		err = store.Delete(root, key)
+	}
+	finished(root, opDelete, path, err)
+	return err
+}
+
+// uploadOptions returns the multipart options of the sync, the progress of the upload is recorded in the stats.
+func uploadOptions(root string, s *config.Sync, path string) storage.UploadOptions {
+	opts := storage.UploadOptions{
+		PartSize:    s.PartSize,
+		Concurrency: s.PartConcurrency,
+	}
+	opts.Progress = func(sent, total int64) {
+		progress(root, path, sent, total)
+	}
+	return opts
+}
@@ -7,9 +7,13 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/akinbezatoglu/s3ync/internal/service/backend"
 	"github.com/akinbezatoglu/s3ync/internal/service/config"
-	"github.com/akinbezatoglu/s3ync/internal/service/ops"
+	"github.com/akinbezatoglu/s3ync/internal/service/ignore"
+	"github.com/akinbezatoglu/s3ync/internal/service/queue"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -18,19 +22,33 @@ type Watcher struct {
 }
 
 var (
-	done    chan struct{}  // waits for a signal to stop
-	addPath chan string    // receives a path to add to the watcher
-	rmPath  chan string    // receives a path to remove from the watcher
-	wg      sync.WaitGroup // waits for all events to be handled.
+	done    chan struct{} // waits for a signal to stop
+	addPath chan string   // receives a path to add to the watcher
+	rmPath  chan string   // receives a path to remove from the watcher
+	stop    sync.Once     // the watcher is stopped only once
+	drained sync.Once     // the queue and the state database are closed only once
 )
 
-var syncs *config.Syncs
-var bucketbasics *ops.BucketBasics
+var (
+	syncs     *config.Syncs
+	syncsMu   sync.RWMutex               // guards syncs, paused and matchers, syncs is replaced when the config file changes
+	paused    map[string]bool            // aws profiles whose syncs are suspended
+	matchers  map[string]*ignore.Matcher // ignored paths of the syncs. Key: root path of the sync
+	startedAt time.Time
+	backends  *backend.Pool // storage backends of the syncs
+	store     *state.Store  // files synced by the service
+	jobs      *queue.Queue  // uploads and deletes waiting for a worker
+	workers   int
+)
+
+// configReloadDelay waits for the config file to be completely written before reloading it.
+const configReloadDelay = 200 * time.Millisecond
 
 func InitWatcher() (*Watcher, error) {
 	done = make(chan struct{})
 	addPath = make(chan string)
 	rmPath = make(chan string)
+	startedAt = time.Now()
 
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -38,11 +56,36 @@ func InitWatcher() (*Watcher, error) {
 	}
 
 	// Gets all pre-configured paths and bucket infos from config file
-	syncs = config.GetAllSyncList()
+	syncs, err = config.GetAllSyncList()
+	if err != nil {
+		return nil, &WatcherFailedInitError{Err: err}
+	}
+	paused = make(map[string]bool)
+	for p := range syncs.Paused {
+		paused[p] = true
+	}
+	matchers, err = newMatchers(syncs)
+	if err != nil {
+		return nil, &WatcherFailedInitError{Err: err}
+	}
 
-	bucketbasics, err = ops.NewBucketBasics()
+	backends = backend.NewPool()
+
+	store, err = state.Open(state.StoreFile())
 	if err != nil {
-		return nil, &ops.S3ClientFailedError{Err: err}
+		return nil, err
+	}
+
+	opts, err := config.GetServiceOptions()
+	if err != nil {
+		return nil, &WatcherFailedInitError{Err: err}
+	}
+	workers = opts.Workers
+	backoff.Attempts = opts.RetryAttempts
+	retryInterval = opts.RetryInterval
+	jobs = queue.New(opts.Workers, opts.QueueSize)
+	for path, s := range syncs.All {
+		jobs.SetLimit(path, s.Concurrency)
 	}
 
 	return &Watcher{w}, nil
@@ -51,21 +94,242 @@ func InitWatcher() (*Watcher, error) {
 // AddPathsAlreadyConfigured adds pre-configured paths to the watcher
 func (w *Watcher) AddPathsAlreadyConfigured() {
 	if len(syncs.All) != 0 {
-		// map[string][]string
-		// Key: filesytem path, Value: [aws-profile, bucket-name]
-		for path := range syncs.All {
-			home, _ := os.UserHomeDir()
-			// Watcher runs in a container. So event.Name/s is related to container paths.
-			// Removes home/userprofile from path to set container's home as container path
-			w.AddPathRecursive(strings.Replace(path, home, "", 1))
+		// map[string]*config.Sync
+		// Key: filesytem path
+		for path, s := range syncs.All {
+			if !paused[s.Profile] {
+				w.AddPathRecursive(localPath(path))
+			}
+		}
+	}
+}
+
+// WatchConfig reloads the syncs whenever the s3ync cli writes the config file.
+// Newly added syncs are sent to the watcher to be watched and uploaded.
+// It returns when the watcher is stopped.
+func (w *Watcher) WatchConfig() error {
+	cfgWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return &WatcherFailedInitError{Err: err}
+	}
+	defer cfgWatcher.Close()
+	// The directory is watched instead of the file, the file may be replaced instead of written.
+	if err := cfgWatcher.Add(config.ConfigDir()); err != nil {
+		return &WatcherFailedInitError{Err: err}
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case event, ok := <-cfgWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(config.ConfigFile()) &&
+				(event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+				reload = time.After(configReloadDelay)
+			}
+		case err, ok := <-cfgWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Println(&EventError{err})
+		case <-reload:
+			reload = nil
+			if err := w.Reload(); err != nil {
+				fmt.Println(err)
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// Reload reads the config file again and sends the added, removed, suspended and resumed syncs to the watcher.
+func (w *Watcher) Reload() error {
+	s, err := config.GetAllSyncList()
+	if err != nil {
+		return err
+	}
+	m, err := newMatchers(s)
+	if err != nil {
+		return err
+	}
+
+	syncsMu.Lock()
+	// Profiles suspended or resumed in the config file since the last read.
+	// Profiles paused only through the control socket keep their state.
+	wasPaused := make(map[string]bool)
+	for p, v := range paused {
+		wasPaused[p] = v
+	}
+	for p := range s.Paused {
+		if !syncs.Paused[p] {
+			paused[p] = true
+		}
+	}
+	for p := range syncs.Paused {
+		if !s.Paused[p] {
+			paused[p] = false
+		}
+	}
+
+	var added, removed, created []string
+	for path, n := range s.All {
+		o, ok := syncs.All[path]
+		if !ok {
+			created = append(created, path)
+		}
+		active := !paused[n.Profile]
+		wasActive := ok && !wasPaused[o.Profile]
+		if active && !wasActive {
+			added = append(added, path)
+		}
+		if !active && wasActive {
+			removed = append(removed, path)
+		}
+	}
+	var deleted []string
+	for path, o := range syncs.All {
+		if _, ok := s.All[path]; !ok {
+			deleted = append(deleted, path)
+			if !wasPaused[o.Profile] {
+				removed = append(removed, path)
+			}
+		}
+	}
+	syncs = s
+	matchers = m
+	syncsMu.Unlock()
+
+	for path, s := range s.All {
+		jobs.SetLimit(path, s.Concurrency)
+	}
+	for _, path := range created {
+		// The state left by an older sync of the root is not the state of the new sync, its bucket may
+		// be another one. It is removed before the first reconciliation of the sync.
+		if err := store.DeleteSync(path); err != nil {
+			fmt.Println(err)
+		}
+	}
+	for _, path := range deleted {
+		jobs.SetLimit(path, 0)
+		if err := store.DeleteSync(path); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	for _, path := range removed {
+		send(rmPath, path)
+	}
+	for _, path := range added {
+		send(addPath, path)
+	}
+	return nil
+}
+
+// getSync returns the root of the sync that path belongs to and the sync.
+func getSync(path string) (string, *config.Sync, bool) {
+	syncsMu.RLock()
+	defer syncsMu.RUnlock()
+	for root, s := range syncs.All {
+		if paused[s.Profile] {
+			continue
+		}
+		l := filepath.ToSlash(localPath(root))
+		if p := filepath.ToSlash(path); p == l || strings.HasPrefix(p, l+"/") {
+			return root, s, true
+		}
+	}
+	return "", nil, false
+}
+
+// isActive reports whether the sync whose root is root is still configured and not paused.
+func isActive(root string) bool {
+	syncsMu.RLock()
+	defer syncsMu.RUnlock()
+	s, ok := syncs.All[root]
+	return ok && !paused[s.Profile]
+}
+
+// newMatchers returns the matchers of the ignored paths of the syncs.
+func newMatchers(s *config.Syncs) (map[string]*ignore.Matcher, error) {
+	m := make(map[string]*ignore.Matcher)
+	for root, sync := range s.All {
+		matcher, err := ignore.New(localPath(root), sync.Include, sync.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("sync %v: %v", root, err)
 		}
+		m[root] = matcher
+	}
+	return m, nil
+}
+
+// ignored reports whether the path of the sync whose root is root is not synced.
+func ignored(root, path string, isDir bool) bool {
+	syncsMu.RLock()
+	m := matchers[root]
+	syncsMu.RUnlock()
+	return m != nil && m.Ignored(relativePath(root, path), isDir)
+}
+
+// skipIgnored reports whether the walks of the syncs skip the path. The error is returned by the walk,
+// it is filepath.SkipDir for an ignored directory so it is not walked into.
+func skipIgnored(path string, info os.FileInfo) (bool, error) {
+	root, _, ok := getSync(path)
+	if !ok || !ignored(root, path, info.IsDir()) {
+		return false, nil
+	}
+	if info.IsDir() {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
+
+// send passes the path to the watcher unless it is stopped.
+func send(c chan string, path string) {
+	select {
+	case c <- path:
+	case <-done:
+	}
+}
+
+// Watcher runs in a container. So event.Name/s is related to container paths.
+// localPath removes home/userprofile from the configured path to set container's home as container path.
+func localPath(path string) string {
+	home, _ := os.UserHomeDir()
+	return strings.Replace(path, home, "", 1)
+}
+
+// addSync watches a newly configured or resumed sync and uploads the contents of its root
+// that are missing or changed in the bucket.
+func (w *Watcher) addSync(path string) {
+	_, s, ok := getSync(localPath(path))
+	if !ok {
+		return
 	}
+	fmt.Printf("Added sync: %q\n", path)
+	w.AddPathRecursive(localPath(path))
+	// The bucket is listed and the uploads are queued out of the event loop.
+	// The bucket may have objects that were not uploaded by the sync, nothing is deleted.
+	go func() {
+		if err := reconcile(path, s, config.DeleteKeep); err != nil {
+			fmt.Printf("Couldn't reconcile %v with %v. Here's why: %v\n", path, s.Bucket, err)
+		}
+	}()
 }
 
 // (*fsnotify.Watcher).Add() function do not add recursively.
 // AddPathRecursive recursively adds all directories inside the root path to the watcher.
 func (w *Watcher) AddPathRecursive(root string) {
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		// Ignored directories are not watched, they would use up the watches of the system.
+		if skip, err := skipIgnored(path, info); skip {
+			return err
+		}
 		if info.IsDir() {
 			w.Add(path)
 		}
@@ -75,6 +339,12 @@ func (w *Watcher) AddPathRecursive(root string) {
 
 func (w *Watcher) AddPathRecursiveAndUpload(root, bucketname, rootDirObjectKey, profile string) {
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if skip, err := skipIgnored(path, info); skip {
+			return err
+		}
 		if info.IsDir() {
 			// If it is a directory, add it to the watcher.
 			// Only directories will be added to the watcher.
@@ -83,7 +353,13 @@ func (w *Watcher) AddPathRecursiveAndUpload(root, bucketname, rootDirObjectKey,
 			// If added is a file, It does not need to be added to the watcher.
 			// Just upload it to the bucket.
 			relativepath := strings.TrimPrefix(filepath.ToSlash(path), filepath.ToSlash(root))
-			go bucketbasics.UploadFile(bucketname, rootDirObjectKey+relativepath, path, profile)
+			// The root of a sync is uploaded with an empty object key, relativepath starts with a slash.
+			objectKey := strings.TrimPrefix(rootDirObjectKey+relativepath, "/")
+			syncroot, s, ok := getSync(path)
+			if !ok {
+				return nil
+			}
+			enqueue(syncroot, opUpload, uploadSettled(syncroot, s, objectKey, path))
 		}
 		return nil
 	})
@@ -93,10 +369,11 @@ func (w *Watcher) AddPathRecursiveAndUpload(root, bucketname, rootDirObjectKey,
 // RemovePathRecursive recursively removes all sub-directories of the root path from the watcher.
 func (w *Watcher) RemovePathRecursive(root string) {
 	watches := w.WatchList()
+	root = filepath.ToSlash(root)
 	for _, watch := range watches {
-		if strings.Contains(watch, root) {
+		if p := filepath.ToSlash(watch); p == root || strings.HasPrefix(p, root+"/") {
 			// watch is a subdir of the root dir
-			err := w.Remove(filepath.ToSlash(watch))
+			err := w.Remove(watch)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -105,51 +382,95 @@ func (w *Watcher) RemovePathRecursive(root string) {
 	}
 }
 
-// Watch watches and handles events async
+// Watch watches events and queues their uploads and deletes.
+// While the queue is full, the events wait in the watcher until a worker is free.
 func (w *Watcher) Watch() error {
 	for {
 		select {
 		case event, ok := <-w.Events:
 			if !ok {
+				drain()
 				return nil
 			}
-			wg.Add(1)
-			go w.handleEvent(event)
+			w.handleEvent(event)
+		case path := <-addPath:
+			w.addSync(path)
+		case path := <-rmPath:
+			fmt.Printf("Removed sync: %q\n", path)
+			w.RemovePathRecursive(localPath(path))
 		case err, ok := <-w.Errors:
 			if !ok {
 				return &EventError{err}
 			}
 		case <-done:
-			wg.Wait()
+			drain()
 			return nil
 		}
 	}
 }
 
-// Close path channels and lastly done channel to send stop signal to the watcher
+// drain queues the paths waiting for their debounce window, waits for the running operations to finish
+// and closes the state database. It runs once, the other callers wait until it is done.
+func drain() {
+	drained.Do(func() {
+		flushPending()
+		if dropped := jobs.Close(); dropped != 0 {
+			fmt.Printf("Dropped %v queued operations, they are synced when the service starts again\n", dropped)
+		}
+		if err := store.Close(); err != nil {
+			fmt.Println(err)
+		}
+	})
+}
+
+// Close done channel to send stop signal to the watcher.
+// Watch returns after the in-flight uploads are drained, the queued operations are dropped.
+// Path channels are left open, the config watcher and the control socket may still be sending to them.
 func (w *Watcher) Stop() {
-	close(addPath)
-	close(rmPath)
-	close(done)
-	w.Close()
+	stop.Do(func() {
+		close(done)
+		// Closing the queue also releases the event loop if it is waiting for a free slot,
+		// Watch returns once the drain started here is done.
+		go drain()
+	})
 }
 
 func (w *Watcher) handleEvent(e fsnotify.Event) {
-	defer wg.Done()
-	var profile, bucketname, relativepath string
-	for path := range syncs.All {
-		if strings.Contains(filepath.ToSlash(e.Name), path) {
-			profile = syncs.All[path][0]
-			bucketname = syncs.All[path][1]
+	root, s, ok := getSync(e.Name)
+	if !ok {
+		return
+	}
+	profile, bucketname := s.Profile, s.Bucket
+	if eventIgnored(root, e) {
+		return
+	}
 
-			//ex. /path/to/watch -> event (Create): /path/to/watch/file1.txt
-			// 	  relativepath: file1.txt
-			relativepath = strings.TrimPrefix(filepath.ToSlash(e.Name), filepath.ToSlash(path))[1:]
-			break
+	//ex. /path/to/watch -> event (Create): /path/to/watch/file1.txt
+	// 	  relativepath: file1.txt
+	relativepath := relativePath(root, e.Name)
+
+	if filepath.Base(e.Name) == ignore.FileName {
+		// The rules of the directory are read again, the paths it does not ignore anymore are watched and uploaded.
+		// The ignore file itself is synced like any other file.
+		dir := filepath.Dir(e.Name)
+		syncsMu.RLock()
+		if m := matchers[root]; m != nil {
+			m.Invalidate(relativePath(root, dir))
 		}
+		syncsMu.RUnlock()
+		w.AddPathRecursiveAndUpload(dir, bucketname, relativePath(root, dir), profile)
 	}
 
 	if e.Has(fsnotify.Create) {
+		if r := matchRename(root, e.Name); r != nil {
+			fmt.Printf("Renamed %q to %q\n", r.path, e.Name)
+			// The new name is watched, its objects are copied from the old name in the bucket.
+			w.AddPathRecursive(e.Name)
+			enqueue(root, opUpload, func() {
+				move(r, s, e.Name)
+			})
+			return
+		}
 		if fileInfo, err := os.Stat(e.Name); err == nil && fileInfo.IsDir() {
 			if empty, err := isDirEmpty(e.Name); err == nil && empty {
 				fmt.Printf("Created empty directory: %q", e.Name)
@@ -162,7 +483,7 @@ func (w *Watcher) handleEvent(e fsnotify.Event) {
 			}
 		} else {
 			fmt.Printf("Created file: %q\n", e.Name)
-			bucketbasics.UploadFile(bucketname, relativepath, e.Name, profile)
+			debounce(e.Name, s, true)
 		}
 		return
 	}
@@ -173,7 +494,8 @@ func (w *Watcher) handleEvent(e fsnotify.Event) {
 			// All directories are watched recursively.
 			// Receiving a Write event from a directory is redundant.
 			// File updates are necessary only in the presence of a Write event specific to a file.
-			bucketbasics.UploadFile(bucketname, relativepath, e.Name, profile)
+			// A burst of writes is synced once, when the file is quiet for the debounce window.
+			debounce(e.Name, s, false)
 		}
 		return
 	}
@@ -181,17 +503,32 @@ func (w *Watcher) handleEvent(e fsnotify.Event) {
 	// When a file/directory is renamed, the Watcher catches two events.
 	// Rename and  Create. Rename has the old name, and Create has the new name.
 	// Rename logic needs to be handled in two events.
-	// Respectively, Rename removes first the old named file/directory.
-	// So, Rename shares the same logic with the Remove event.
-	// After, Create will upload the newly named file/directory.
+	// Respectively, Rename keeps the old named file/directory for the rename window.
+	// If Create of the new name comes in the window, the objects are copied to the new name in the bucket.
+	// Otherwise, Rename shares the same logic with the Remove event,
+	// and Create will upload the newly named file/directory.
 	if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
 		fmt.Printf("Removed directory: %q\n", e.Name)
 		w.RemovePathRecursive(e.Name)
-		bucketbasics.DeleteDirectory(bucketname, relativepath, profile)
+		if e.Has(fsnotify.Rename) {
+			rename(root, s, e.Name)
+			return
+		}
+		debounce(e.Name, s, false)
 		return
 	}
 }
 
+// eventIgnored reports whether the path of the event is not synced. A removed path can not be
+// checked for a directory anymore, it is ignored if it is ignored either as a file or as a directory.
+func eventIgnored(root string, e fsnotify.Event) bool {
+	if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
+		return ignored(root, e.Name, false) || ignored(root, e.Name, true)
+	}
+	info, err := os.Stat(e.Name)
+	return ignored(root, e.Name, err == nil && info.IsDir())
+}
+
 func isDirEmpty(name string) (bool, error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -2,31 +2,41 @@ package add
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
-	"github.com/akinbezatoglu/s3ync/internal/sync/s3"
+	"github.com/akinbezatoglu/s3ync/internal/service/ops"
 	"github.com/spf13/cobra"
 )
 
 func NewCmdAdd(cfg config.Config) *cobra.Command {
-	var newProfile string
+	var newProfile, endpoint, caBundle string
+	var pathStyle, insecureTLS bool
 	var cmd = &cobra.Command{
 		Use:  "add",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			isAwsCfg := s3.IsProfileExistInAwsConfig(newProfile)
-			isInCfgFile := cfg.IsProfileExistInConfigFile(newProfile)
+			isAwsCfg := ops.IsProfileExistInAwsConfig(newProfile)
+			isInCfgFile := cfg.IsBackendProfileExist("s3", newProfile)
 			if isAwsCfg && !isInCfgFile {
-				p_with_region := s3.GetLocalAwsProfilesWithDefaultRegion()
+				p_with_region := ops.GetLocalAwsProfilesWithDefaultRegion()
 				for i := 0; i < len(p_with_region)/2; i++ {
 					if p_with_region[i*2] == newProfile {
 						cfg.Set([]string{"s3", "profiles", newProfile}, "")
 						cfg.Set([]string{"s3", "profiles", newProfile, "region"}, p_with_region[i*2+1])
 						cfg.Set([]string{"s3", "profiles", newProfile, "syncs"}, "")
+						setEndpoint(cfg, newProfile, endpoint, pathStyle, insecureTLS, caBundle)
 						cfg.Write()
 					}
 				}
 				fmt.Printf("Succesfully, %v added to config file", newProfile)
+			} else if isAwsCfg && isInCfgFile && endpoint != "" {
+				setEndpoint(cfg, newProfile, endpoint, pathStyle, insecureTLS, caBundle)
+				if err := cfg.Write(); err != nil {
+					fmt.Println(err)
+					return
+				}
+				fmt.Printf("Succesfully, the endpoint of %v is set to %v", newProfile, endpoint)
 			} else if isAwsCfg && isInCfgFile {
 				fmt.Printf("%v is already configured", newProfile)
 			} else {
@@ -36,6 +46,26 @@ func NewCmdAdd(cfg config.Config) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&newProfile, "profile", "", "Add new profile to config file")
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "Url of an S3 compatible server, ex. MinIO, Ceph, Wasabi or LocalStack")
+	cmd.Flags().BoolVar(&pathStyle, "path-style", false, "Put the bucket in the path of the urls instead of their host (with --endpoint)")
+	cmd.Flags().BoolVar(&insecureTLS, "insecure-tls", false, "Do not verify the certificate of the endpoint (with --endpoint)")
+	cmd.Flags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the certificate authorities of the endpoint (with --endpoint)")
 
 	return cmd
 }
+
+// setEndpoint points the profile to an S3 compatible server, nothing is set without an endpoint.
+func setEndpoint(cfg config.Config, profile, endpoint string, pathStyle, insecureTLS bool, caBundle string) {
+	if endpoint == "" {
+		return
+	}
+	settings := map[string]string{
+		"endpoint":     endpoint,
+		"path_style":   strconv.FormatBool(pathStyle),
+		"insecure_tls": strconv.FormatBool(insecureTLS),
+		"ca_bundle":    caBundle,
+	}
+	for key, value := range settings {
+		cfg.Set([]string{"s3", "profiles", profile, key}, value)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"os"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
-	"github.com/akinbezatoglu/s3ync/internal/sync/s3"
+	"github.com/akinbezatoglu/s3ync/internal/service/ops"
 	addCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/config/add"
 	initCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/config/init"
 	listCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/config/list"
@@ -19,7 +19,7 @@ func NewCmdConfig(cfg config.Config) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			// ~/.aws/config file does not exist or never configured in aws cli.
-			if !s3.IsAwsCliConfigured() {
+			if !ops.IsAwsCliConfigured() {
 				fmt.Println("To get started with s3ync, you need to install and configure aws-cli (https://github.com/aws/aws-cli)")
 				os.Exit(1)
 			}
@@ -5,7 +5,7 @@ import (
 	"os"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
-	"github.com/akinbezatoglu/s3ync/internal/sync/s3"
+	"github.com/akinbezatoglu/s3ync/internal/service/ops"
 	"github.com/spf13/cobra"
 )
 
@@ -14,7 +14,7 @@ func NewInitCmd(cfg config.Config) *cobra.Command {
 		Use:  "init",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			profiles := s3.GetLocalAwsProfilesWithDefaultRegion()
+			profiles := ops.GetLocalAwsProfilesWithDefaultRegion()
 			// add profiles to config file with the region values
 			for i := 0; i < len(profiles)/2; i++ {
 				cfg.Set([]string{"s3", "profiles", profiles[i*2]}, "")
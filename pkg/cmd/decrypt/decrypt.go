@@ -0,0 +1,67 @@
+package decrypt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/crypt"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdDecrypt(cfg config.Config) *cobra.Command {
+	var keyFile, in, out string
+	var cmd = &cobra.Command{
+		Use:  "decrypt",
+		Long: `Decrypt an object of a sync with client_encryption, downloaded from its bucket without s3ync.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if keyFile == "" || in == "" || out == "" {
+				fmt.Println("--key-file, --in and --out are required")
+				os.Exit(1)
+			}
+			if err := decryptFile(keyFile, in, out); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Succesfully, %v is decrypted to %v\n", in, out)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Key file of the client_encryption of the sync")
+	cmd.Flags().StringVarP(&in, "in", "i", "", "Encrypted object downloaded from the bucket")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "File to write the decrypted content to")
+	return cmd
+}
+
+// decryptFile decrypts the file in to the file out. The content is written to a temporary file first,
+// so out is never left with the part of a damaged object decrypted before the damage.
+func decryptFile(keyFile, in, out string) error {
+	key, err := crypt.ReadKeyFile(keyFile)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	r, err := crypt.NewDecryptReader(key, src)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".s3ync-decrypt-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), out)
+}
@@ -1,20 +1,194 @@
 package destroy
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/prompt"
+	"github.com/akinbezatoglu/s3ync/internal/service/backend"
+	serviceconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
 	"github.com/spf13/cobra"
 )
 
 func NewCmdDestroy(cfg config.Config) *cobra.Command {
+	var yes, yesRemote, remote bool
+	var timeout time.Duration
 	var cmd = &cobra.Command{
 		Use:  "destroy",
-		Long: ``,
+		Long: `Stop the s3ync service and remove the config directory with its state and log files`,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync destroy")
+			dir := cfg.GetConfigDir()
+			if err := checkConfigDir(dir); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if !yes && !prompt.Confirm(fmt.Sprintf("s3ync service will be stopped and %v will be removed. Are you sure?", dir)) {
+				fmt.Println("Aborted, nothing is changed.")
+				os.Exit(1)
+			}
+			syncs, err := getSyncs(cfg)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			client := control.NewClient()
+			var notRunning *control.ServiceNotRunningError
+			if err := client.Stop(); err == nil {
+				fmt.Println("Waiting for the in-flight uploads to finish...")
+				if err := client.WaitStopped(timeout); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				fmt.Println("Stopped s3ync service")
+			} else if !errors.As(err, &notRunning) {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if remote && len(syncs) != 0 {
+				// The service is stopped, the state has the objects of its last uploads as well.
+				keys, err := syncedKeys(syncs)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				var n int
+				for _, s := range syncs {
+					if len(keys[s.local]) != 0 {
+						fmt.Printf("- %v objects uploaded from %v to the bucket %v (profile: %v)\n", len(keys[s.local]), s.local, s.bucket, s.profile)
+						n += len(keys[s.local])
+					}
+				}
+				if n == 0 {
+					fmt.Println("There is no object uploaded by the syncs to delete from the buckets")
+				} else if !yesRemote && !prompt.Confirm(fmt.Sprintf(
+					"These %v objects will be deleted from the buckets. The other objects of the buckets and their trash are kept. Are you really sure?", n)) {
+					fmt.Printf("Aborted, s3ync service is stopped, the buckets and %v are not changed.\n", dir)
+					os.Exit(1)
+				}
+				all, err := serviceconfig.GetAllSyncList()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				backends := backend.NewPool()
+				for _, s := range syncs {
+					if len(keys[s.local]) == 0 {
+						continue
+					}
+					b, err := backends.Get(all.All[s.local])
+					if err == nil {
+						// Only the objects the sync uploaded are deleted, the bucket may have others.
+						err = b.Delete(keys[s.local])
+					}
+					if err != nil {
+						fmt.Printf("Couldn't delete the objects of %v in the bucket %v. Here's why: %v\n", s.local, s.bucket, err)
+						os.Exit(1)
+					}
+					fmt.Printf("Deleted the %v objects of %v in the bucket %v (profile: %v)\n", len(keys[s.local]), s.local, s.bucket, s.profile)
+				}
+			}
+
+			removed, err := removeConfigDir(dir)
+			for _, path := range removed {
+				fmt.Printf("Removed %v\n", path)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Succesfully, s3ync is destroyed. %v files are removed.\n", len(removed))
 		},
 	}
 
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation to stop the service and remove the config directory")
+	cmd.Flags().BoolVar(&remote, "remote", false, "Delete the objects uploaded by the syncs from the buckets as well")
+	cmd.Flags().BoolVar(&yesRemote, "yes-remote", false, "Do not ask for confirmation to delete the objects with --remote")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Time to wait for the in-flight uploads to finish")
+
 	return cmd
 }
+
+type syncInfo struct {
+	profile, local, bucket string
+}
+
+func getSyncs(cfg config.Config) ([]syncInfo, error) {
+	profiles, err := cfg.GetProfileNames()
+	if err != nil {
+		return nil, err
+	}
+	var x []syncInfo
+	for _, profile := range profiles {
+		syncs, err := cfg.GetSyncListFromProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(syncs)/2; i++ {
+			x = append(x, syncInfo{profile: profile, local: syncs[i*2], bucket: syncs[i*2+1]})
+		}
+	}
+	return x, nil
+}
+
+// syncedKeys reads the keys of the objects uploaded by the syncs from the state database. Key: local path of the sync
+func syncedKeys(syncs []syncInfo) (map[string][]string, error) {
+	store, err := state.Open(state.StoreFile())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	keys := make(map[string][]string)
+	for _, s := range syncs {
+		if keys[s.local], err = storage.SyncedKeys(store, s.local, ""); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// checkConfigDir refuses to remove a directory that can not be an s3ync config directory,
+// ex. S3YNC_CONFIG_DIR is set to the home directory.
+func checkConfigDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	home, _ := os.UserHomeDir()
+	if abs == filepath.VolumeName(abs)+string(filepath.Separator) || abs == home {
+		return fmt.Errorf("refusing to remove %v, it is not an s3ync config directory", abs)
+	}
+	return nil
+}
+
+// removeConfigDir removes the config directory and returns the removed files.
+func removeConfigDir(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -1,19 +1,76 @@
 package restart
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
 	"github.com/spf13/cobra"
 )
 
 func NewCmdRestart(cfg config.Config) *cobra.Command {
+	var profile string
+	var timeout time.Duration
 	var cmd = &cobra.Command{
 		Use:  "restart",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync restart")
+			client := control.NewClient()
+
+			if profile != "" {
+				if !cfg.IsProfileExistInConfigFile(profile) {
+					fmt.Printf("%v is not in the config file\n", profile)
+					os.Exit(1)
+				}
+				if err := cfg.SetProfilePaused(profile, false); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				if err := cfg.Write(); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				var notRunning *control.ServiceNotRunningError
+				if err := client.Resume(profile); err != nil {
+					if errors.As(err, &notRunning) {
+						fmt.Printf("s3ync service is not running, the syncs of %v will be restarted when it starts.\n", profile)
+						return
+					}
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				fmt.Printf("Succesfully, the syncs of %v are restarted\n", profile)
+				return
+			}
+
+			if client.IsRunning() {
+				if err := client.Stop(); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				fmt.Println("Waiting for the in-flight uploads to finish...")
+				if err := client.WaitStopped(timeout); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			if err := control.StartService(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := client.WaitRunning(30 * time.Second); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("Succesfully, s3ync service is running")
 		},
 	}
+
+	cmd.Flags().StringVarP(&profile, "profile", "p", "", "Restart only the syncs of the profile")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Time to wait for the in-flight uploads to finish before restarting")
+
 	return cmd
 }
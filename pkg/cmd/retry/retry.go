@@ -0,0 +1,37 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdRetry(cfg config.Config) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:  "retry",
+		Long: ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			n, err := control.NewClient().Retry()
+			if err != nil {
+				var notRunning *control.ServiceNotRunningError
+				if errors.As(err, &notRunning) {
+					fmt.Println("s3ync service is not running, the failed operations are synced when it starts.")
+					return
+				}
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if n == 0 {
+				fmt.Println("There is no failed operation to retry.")
+				return
+			}
+			fmt.Printf("Retrying %v failed operations, see s3ync status for the progress\n", n)
+		},
+	}
+
+	return cmd
+}
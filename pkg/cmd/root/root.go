@@ -3,8 +3,10 @@ package root
 import (
 	"github.com/akinbezatoglu/s3ync/internal/config"
 	configCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/config"
+	decryptCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/decrypt"
 	destroyCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/destroy"
 	restartCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/restart"
+	retryCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/retry"
 	statusCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/status"
 	stopCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/stop"
 	syncCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/sync"
@@ -29,6 +31,8 @@ func NewCmdRoot(cfg config.Config) *cobra.Command {
 	cmd.AddCommand(restartCmd.NewCmdRestart(cfg))
 	cmd.AddCommand(stopCmd.NewCmdStop(cfg))
 	cmd.AddCommand(destroyCmd.NewCmdDestroy(cfg))
+	cmd.AddCommand(retryCmd.NewCmdRetry(cfg))
+	cmd.AddCommand(decryptCmd.NewCmdDecrypt(cfg))
 
 	return cmd
 }
@@ -1,20 +1,137 @@
 package status
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
 	"github.com/spf13/cobra"
 )
 
+// statusOutput is the output of the status command.
+type statusOutput struct {
+	Running bool   `json:"running"`
+	Uptime  string `json:"uptime,omitempty"`
+	*control.Status
+}
+
 func NewCmdStatus(cfg config.Config) *cobra.Command {
+	var asJSON bool
 	var cmd = &cobra.Command{
 		Use:  "status",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync status")
+			out, err := getStatus(cfg)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(out); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				return
+			}
+			printStatus(out)
 		},
 	}
 
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the status in JSON")
+
 	return cmd
 }
+
+// getStatus asks the running service for its status.
+// If the service is not running, the syncs are read from the config file.
+func getStatus(cfg config.Config) (*statusOutput, error) {
+	status, err := control.NewClient().Status()
+	if err == nil {
+		return &statusOutput{
+			Running: true,
+			Uptime:  time.Since(status.StartedAt).Round(time.Second).String(),
+			Status:  status,
+		}, nil
+	}
+	var notRunning *control.ServiceNotRunningError
+	if !errors.As(err, &notRunning) {
+		return nil, err
+	}
+
+	status = &control.Status{}
+	profiles, err := cfg.GetProfileNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		syncs, err := cfg.GetSyncListFromProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(syncs)/2; i++ {
+			status.Syncs = append(status.Syncs, control.SyncStatus{
+				Local:   syncs[i*2],
+				Profile: profile,
+				Bucket:  syncs[i*2+1],
+			})
+		}
+	}
+	return &statusOutput{Running: false, Status: status}, nil
+}
+
+func printStatus(out *statusOutput) {
+	if out.Running {
+		fmt.Printf("s3ync service is running (uptime: %v)\n", out.Uptime)
+		fmt.Printf("queue: %v operations waiting for %v workers\n", out.QueueDepth, out.Workers)
+	} else {
+		fmt.Println("s3ync service is not running")
+	}
+	if len(out.Syncs) == 0 {
+		fmt.Println("There is no sync data.")
+	}
+	for _, s := range out.Syncs {
+		fmt.Printf("- local: %v\n", s.Local)
+		fmt.Printf("  bucket: %v\n", s.Bucket)
+		fmt.Printf("  profile: %v\n", s.Profile)
+		if !out.Running {
+			continue
+		}
+		if s.Paused {
+			fmt.Println("  paused: true")
+		}
+		fmt.Printf("  delete: %v\n", s.Delete)
+		fmt.Printf("  watches: %v\n", s.Watches)
+		fmt.Printf("  uploads: %v queued, %v in flight\n", s.QueuedUploads, s.InflightUploads)
+		for _, u := range s.Uploads {
+			fmt.Printf("  - %v: %v/%v bytes\n", u.Path, u.Sent, u.Total)
+		}
+		fmt.Printf("  deletes: %v queued, %v in flight\n", s.QueuedDeletes, s.InflightDeletes)
+		for _, path := range s.Unstable {
+			fmt.Printf("  uploaded while changing: %v\n", path)
+		}
+		if s.Failed != 0 {
+			fmt.Printf("  failed: %v, retry them with s3ync retry\n", s.Failed)
+		}
+		if r := s.Reconciled; r != nil {
+			fmt.Printf("  reconciled: %v uploads, %v deletes, %v unchanged (%v)\n",
+				r.Uploads, r.Deletes, r.Unchanged, r.Time.Local().Format(time.RFC3339))
+		}
+		if s.LastSync != nil {
+			fmt.Printf("  last sync: %v\n", s.LastSync.Local().Format(time.RFC3339))
+		} else {
+			fmt.Println("  last sync: never")
+		}
+	}
+	if len(out.RecentErrors) != 0 {
+		fmt.Println("Recent errors:")
+		for _, e := range out.RecentErrors {
+			fmt.Printf("- %v %v: %v\n", e.Time.Local().Format(time.RFC3339), e.Path, e.Error)
+		}
+	}
+}
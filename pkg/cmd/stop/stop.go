@@ -1,19 +1,67 @@
 package stop
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
 	"github.com/spf13/cobra"
 )
 
 func NewCmdStop(cfg config.Config) *cobra.Command {
+	var profile string
+	var timeout time.Duration
 	var cmd = &cobra.Command{
 		Use:  "stop",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync stop")
+			client := control.NewClient()
+			var notRunning *control.ServiceNotRunningError
+
+			if profile != "" {
+				if !cfg.IsProfileExistInConfigFile(profile) {
+					fmt.Printf("%v is not in the config file\n", profile)
+					os.Exit(1)
+				}
+				// The profile stays suspended when the service is restarted.
+				if err := cfg.SetProfilePaused(profile, true); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				if err := cfg.Write(); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				if err := client.Pause(profile); err != nil && !errors.As(err, &notRunning) {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				fmt.Printf("Succesfully, the syncs of %v are stopped\n", profile)
+				return
+			}
+
+			if err := client.Stop(); err != nil {
+				if errors.As(err, &notRunning) {
+					fmt.Println("s3ync service is not running")
+					return
+				}
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("Waiting for the in-flight uploads to finish...")
+			if err := client.WaitStopped(timeout); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("Succesfully, s3ync service is stopped")
 		},
 	}
+
+	cmd.Flags().StringVarP(&profile, "profile", "p", "", "Stop only the syncs of the profile")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Time to wait for the in-flight uploads to finish")
+
 	return cmd
 }
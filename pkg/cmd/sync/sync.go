@@ -1,22 +1,391 @@
 package sync
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	serviceconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/crypt"
+	"github.com/akinbezatoglu/s3ync/internal/service/ignore"
+	"github.com/akinbezatoglu/s3ync/internal/service/ops"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
 	syncListCmd "github.com/akinbezatoglu/s3ync/pkg/cmd/sync/list"
 	"github.com/spf13/cobra"
 )
 
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// https://learn.microsoft.com/en-us/rest/api/storageservices/naming-and-referencing-containers--blobs--and-metadata
+var containerNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// https://cloud.google.com/storage/docs/buckets#naming
+var gcsBucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,61}[a-z0-9]$`)
+
 func NewCmdSync(cfg config.Config) *cobra.Command {
+	var local, bucket, profile, deletePolicy, backend string
+	var encryptionType, kmsKeyID, keyFile, clientKeyFile string
+	var recursive, bucketKey bool
+	var partSize, partConcurrency, concurrency int
+	var debounce, stable, stableMaxWait time.Duration
+	var stableCheckOpen, createBucket bool
+	var include, exclude []string
 	var cmd = &cobra.Command{
 		Use:  "sync",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync sync")
+			path, target, err := validateSync(cfg, local, bucket, profile, backend)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			bucket = target
+			policy, err := getDeletePolicy(deletePolicy, recursive)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if createBucket && backend != "s3" {
+				fmt.Println("--create-bucket can be used with the s3 backend only")
+				os.Exit(1)
+			}
+			if partSize < 0 || partConcurrency < 0 || concurrency < 0 || debounce < 0 || stable < 0 || stableMaxWait < 0 {
+				fmt.Println("--part-size, --part-concurrency, --concurrency, --debounce, --stable and --stable-max-wait can not be negative")
+				os.Exit(1)
+			}
+			encryption, err := getEncryption(encryptionType, kmsKeyID, bucketKey, keyFile, backend)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			clientKey, err := getClientKeyFile(clientKeyFile)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if _, err := ignore.New(path, include, exclude); err != nil {
+				fmt.Printf("--include or --exclude has an invalid pattern: %v\n", err)
+				os.Exit(1)
+			}
+			var options []config.SyncOption
+			// The syncs of the blob and gcp backends are listed in their own sections, the local backend's with the s3 syncs.
+			if backend == "local" {
+				options = append(options, config.SyncOption{Keys: []string{"backend"}, Value: backend})
+			}
+			options = append(options, config.SyncOption{Keys: []string{"delete"}, Value: policy})
+			if encryption != nil {
+				options = append(options, config.SyncOption{Keys: []string{"encryption", "type"}, Value: encryption.Type})
+				if encryption.KMSKeyID != "" {
+					options = append(options, config.SyncOption{Keys: []string{"encryption", "kms_key_id"}, Value: encryption.KMSKeyID})
+				}
+				if encryption.BucketKey {
+					options = append(options, config.SyncOption{Keys: []string{"encryption", "bucket_key"}, Value: "true"})
+				}
+				if encryption.KeyFile != "" {
+					options = append(options, config.SyncOption{Keys: []string{"encryption", "key_file"}, Value: encryption.KeyFile})
+				}
+			}
+			if clientKey != "" {
+				options = append(options, config.SyncOption{Keys: []string{"client_encryption", "key_file"}, Value: clientKey})
+			}
+			for key, n := range map[string]int{"part_size": partSize, "part_concurrency": partConcurrency, "concurrency": concurrency} {
+				if n > 0 {
+					options = append(options, config.SyncOption{Keys: []string{key}, Value: strconv.Itoa(n)})
+				}
+			}
+			for key, d := range map[string]time.Duration{"debounce": debounce, "stable": stable, "stable_max_wait": stableMaxWait} {
+				if cmd.Flags().Changed(strings.ReplaceAll(key, "_", "-")) {
+					options = append(options, config.SyncOption{Keys: []string{key}, Value: d.String()})
+				}
+			}
+			// The patterns are written comma separated, the service reads them as a list.
+			for key, patterns := range map[string][]string{"include": include, "exclude": exclude} {
+				if len(patterns) != 0 {
+					options = append(options, config.SyncOption{Keys: []string{key}, Value: strings.Join(patterns, ",")})
+				}
+			}
+			if stableCheckOpen {
+				options = append(options, config.SyncOption{Keys: []string{"stable_check_open"}, Value: "true"})
+			}
+			// The bucket is checked last, it may be created and a probe object is written to it.
+			var region string
+			if backend == "s3" {
+				if region, err = checkBucket(bucket, profile, policy, createBucket, encryption); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			if err := cfg.AddSync(backend, profile, path, bucket, region, options...); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Succesfully, %v is synced with the bucket %v (profile: %v)\n", path, bucket, profile)
+			// Tell the running service to start watching the new directory and upload its contents.
+			if err := control.NewClient().AddSync(path); err != nil {
+				var notRunning *control.ServiceNotRunningError
+				if errors.As(err, &notRunning) {
+					// The state left by an older sync of the directory is not the state of this one.
+					if err := state.DeleteSyncFile(state.StoreFile(), path); err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					fmt.Println("s3ync service is not running, the directory will be synced when it starts.")
+					return
+				}
+				fmt.Println(err)
+				os.Exit(1)
+			}
 		},
 	}
 
+	cmd.Flags().StringVarP(&local, "local", "l", "", "Local directory to listen on")
+	cmd.Flags().StringVarP(&bucket, "bucket", "b", "", "Bucket to sync the local directory, the directory to mirror it into with --backend local")
+	cmd.Flags().StringVarP(&profile, "profile", "p", "default", "Profile of the bucket")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Sync delete events as well, same as --delete mirror")
+	cmd.Flags().IntVar(&partSize, "part-size", 0, "Size of the parts of multipart uploads in MiB (default 5)")
+	cmd.Flags().IntVar(&partConcurrency, "part-concurrency", 0, "Number of parts of a file uploaded in parallel (default 5)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 0, "Maximum uploads and deletes of the sync running at once (default: the service workers)")
+	cmd.Flags().DurationVar(&debounce, "debounce", 500*time.Millisecond, "Time a file must be quiet before its changes are synced, 0 syncs every event")
+	cmd.Flags().DurationVar(&stable, "stable", time.Second, "Time the size and mtime of a file must not change before it is uploaded, 0 uploads it at once")
+	cmd.Flags().DurationVar(&stableMaxWait, "stable-max-wait", 10*time.Minute, "Longest a changing file waits, it is uploaded and flagged after")
+	cmd.Flags().BoolVar(&stableCheckOpen, "stable-check-open", false, "Wait as well for the processes writing to a file to close it (linux)")
+	cmd.Flags().StringSliceVar(&include, "include", nil, "Sync only the files matching these gitignore patterns")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Do not sync the paths matching these gitignore patterns, in addition to the .s3yncignore files")
+	cmd.Flags().StringVar(&backend, "backend", "s3", "Storage backend of the bucket: s3, blob (a container of Azure Blob Storage), gcp (Google Cloud Storage) or local")
+	cmd.Flags().BoolVar(&createBucket, "create-bucket", false, "Create the bucket in the region of the profile if it does not exist (s3 only)")
+	cmd.Flags().StringVar(&encryptionType, "encryption", "", "Server-side encryption of the objects: sse-s3, sse-kms or sse-c (default: the encryption of the bucket)")
+	cmd.Flags().StringVar(&kmsKeyID, "kms-key-id", "", "KMS key of --encryption sse-kms (default: the aws managed key of the account)")
+	cmd.Flags().BoolVar(&bucketKey, "bucket-key", false, "Use an S3 bucket key with --encryption sse-kms")
+	cmd.Flags().StringVar(&keyFile, "sse-c-key-file", "", "File of the 256-bit key of --encryption sse-c, raw or base64 encoded")
+	cmd.Flags().StringVar(&clientKeyFile, "client-key-file", "", "Encrypt the files with AES-256-GCM and the 256-bit key of this file before they are uploaded")
+	cmd.Flags().StringVar(&deletePolicy, "delete", "", "What happens in the bucket when a file is deleted: mirror, keep or archive (default keep)")
+
 	cmd.AddCommand(syncListCmd.NewCmdList())
 	return cmd
 }
+
+// getDeletePolicy returns the delete policy of the sync, --recursive is the mirror policy.
+func getDeletePolicy(policy string, recursive bool) (string, error) {
+	switch policy {
+	case "":
+		if recursive {
+			return "mirror", nil
+		}
+		return "keep", nil
+	case "mirror", "keep", "archive":
+		if recursive && policy != "mirror" {
+			return "", fmt.Errorf("--recursive can not be used with --delete %v", policy)
+		}
+		return policy, nil
+	}
+	return "", fmt.Errorf("%q is not a delete policy, use mirror, keep or archive", policy)
+}
+
+// getEncryption returns the server-side encryption of the sync, nil if --encryption is not set.
+// The key file is stored as an absolute path, the service does not run in the current directory.
+func getEncryption(typ, kmsKeyID string, bucketKey bool, keyFile, backend string) (*serviceconfig.Encryption, error) {
+	if typ == "" {
+		if kmsKeyID != "" || bucketKey || keyFile != "" {
+			return nil, fmt.Errorf("--kms-key-id, --bucket-key and --sse-c-key-file need --encryption")
+		}
+		return nil, nil
+	}
+	if backend != "s3" {
+		return nil, fmt.Errorf("--encryption can be used with the s3 backend only")
+	}
+	if keyFile != "" {
+		abs, err := filepath.Abs(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keyFile = filepath.ToSlash(abs)
+	}
+	return serviceconfig.NewEncryption(typ, kmsKeyID, bucketKey, keyFile)
+}
+
+// getClientKeyFile returns the absolute, slash separated path of the key file of the client-side encryption,
+// empty if the files are not encrypted. The key is read to check it before the sync is added.
+func getClientKeyFile(keyFile string) (string, error) {
+	if keyFile == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(keyFile)
+	if err != nil {
+		return "", err
+	}
+	if _, err := crypt.ReadKeyFile(abs); err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(abs), nil
+}
+
+// checkBucket checks that the profile can read, write and delete the objects of the bucket and returns
+// the region of the bucket to record in the config file. The bucket is created if it is missing and create is true.
+// The objects of a sync whose policy is keep are never deleted, the profile may not be allowed to.
+func checkBucket(bucket, profile, policy string, create bool, encryption *serviceconfig.Encryption) (string, error) {
+	basics, err := ops.NewBucketBasics()
+	if err != nil {
+		return "", &ops.S3ClientFailedError{Err: err}
+	}
+	region, err := basics.CheckBucket(bucket, profile, create, encryption)
+	var denied *ops.AccessDeniedError
+	if errors.As(err, &denied) && denied.Action == "s3:DeleteObject" && policy == "keep" {
+		fmt.Printf("%v, the object %v* written to check the bucket is left in it.\n", err, ops.ProbePrefix)
+		return region, nil
+	}
+	return region, err
+}
+
+// validateSync checks the sync inputs and returns the absolute, slash separated local path to store in the config file,
+// and the bucket. The bucket of the local backend is the absolute, slash separated path of its directory.
+func validateSync(cfg config.Config, local, bucket, profile, backend string) (string, string, error) {
+	if local == "" || bucket == "" {
+		return "", "", fmt.Errorf("both --local and --bucket are required")
+	}
+	path, err := localDir(local)
+	if err != nil {
+		return "", "", err
+	}
+	switch backend {
+	case "s3":
+		if !bucketNameRegexp.MatchString(bucket) || strings.Contains(bucket, "..") {
+			return "", "", fmt.Errorf("%q is not a valid bucket name", bucket)
+		}
+		if !cfg.IsBackendProfileExist("s3", profile) {
+			return "", "", fmt.Errorf("%v is not in the config file. Please add it first: s3ync config add --profile %v", profile, profile)
+		}
+	case "blob":
+		if !containerNameRegexp.MatchString(bucket) || strings.Contains(bucket, "--") {
+			return "", "", fmt.Errorf("%q is not a valid container name", bucket)
+		}
+		if !cfg.IsBackendProfileExist("blob", profile) {
+			return "", "", fmt.Errorf("the storage account of %v is not in the config file. Please add it to blob.profiles.%v", profile, profile)
+		}
+	case "gcp":
+		if !gcsBucketNameRegexp.MatchString(bucket) || strings.Contains(bucket, "..") {
+			return "", "", fmt.Errorf("%q is not a valid bucket name", bucket)
+		}
+		if !cfg.IsBackendProfileExist("gcp", profile) {
+			return "", "", fmt.Errorf("the credentials of %v are not in the config file. Please add them to gcp.profiles.%v", profile, profile)
+		}
+	case "local":
+		// The local backend needs no credentials, the profile only groups the syncs.
+		if bucket, err = localDir(bucket); err != nil {
+			return "", "", err
+		}
+		if isSubPath(path, bucket) || isSubPath(bucket, path) {
+			return "", "", fmt.Errorf("%v can not be mirrored into %v, the directories overlap", path, bucket)
+		}
+	default:
+		return "", "", fmt.Errorf("%q is not a storage backend, use s3, blob, gcp or local", backend)
+	}
+
+	// Events are matched to a sync by its root, so the roots must not overlap.
+	profiles, err := cfg.GetProfileNames()
+	if err != nil {
+		return "", "", err
+	}
+	for _, p := range profiles {
+		syncs, err := cfg.GetSyncListFromProfile(p)
+		if err != nil {
+			return "", "", err
+		}
+		for i := 0; i < len(syncs)/2; i++ {
+			if isSubPath(syncs[i*2], path) || isSubPath(path, syncs[i*2]) {
+				return "", "", fmt.Errorf("%v overlaps with %v, which is already synced with the bucket %v (profile: %v)", path, syncs[i*2], syncs[i*2+1], p)
+			}
+			// The files mirrored into a directory of another sync would be synced again.
+			if backend == "local" && (isSubPath(syncs[i*2], bucket) || isSubPath(bucket, syncs[i*2])) {
+				return "", "", fmt.Errorf("%v can not be mirrored into %v, it overlaps with %v, which is already synced (profile: %v)", path, bucket, syncs[i*2], p)
+			}
+			// A sync deletes the objects of its removed files, the syncs of a bucket would delete each other's objects.
+			if backend == "local" && (isSubPath(syncs[i*2+1], bucket) || isSubPath(bucket, syncs[i*2+1])) {
+				return "", "", fmt.Errorf("the bucket %v is already used by %v (profile: %v), a bucket can be synced with one directory only", bucket, syncs[i*2], p)
+			}
+		}
+	}
+	if backend == "local" {
+		return path, bucket, nil
+	}
+	all, err := serviceconfig.GetAllSyncList()
+	if err != nil {
+		return "", "", err
+	}
+	target := storageTarget(backend, profile, bucket)
+	for local, s := range all.All {
+		if s.Backend == backend && storageTarget(s.Backend, s.Profile, s.Bucket) == target {
+			return "", "", fmt.Errorf("the bucket %v is already used by %v (profile: %v), a bucket can be synced with one directory only", bucket, local, s.Profile)
+		}
+	}
+	return path, bucket, nil
+}
+
+// storageTarget identifies the bucket of the backend, the same name on two S3 compatible servers,
+// in two storage accounts or on two backends is not the same bucket. The names of the buckets of aws
+// and Google Cloud Storage are global, the profiles of the other accounts share them.
+func storageTarget(backend, profile, bucket string) string {
+	var endpoint string
+	switch backend {
+	case "s3":
+		if profiles, err := serviceconfig.GetS3Profiles(); err == nil && profiles[profile] != nil {
+			endpoint = profiles[profile].Endpoint
+		}
+	case "blob":
+		endpoint = profile
+		if p, err := serviceconfig.GetBlobProfile(profile); err == nil {
+			endpoint = blobEndpoint(p)
+		}
+	case "gcp":
+		if p, err := serviceconfig.GetGCPProfile(profile); err == nil {
+			endpoint = p.Endpoint
+		}
+	}
+	return backend + " " + strings.TrimSuffix(endpoint, "/") + " " + bucket
+}
+
+// blobEndpoint returns the url of the blob service of the storage account of the profile.
+func blobEndpoint(p *serviceconfig.BlobProfile) string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	account := p.Account
+	for _, setting := range strings.Split(p.ConnectionString, ";") {
+		key, value, _ := strings.Cut(setting, "=")
+		switch key {
+		case "BlobEndpoint":
+			return value
+		case "AccountName":
+			account = value
+		}
+	}
+	return "https://" + account + ".blob.core.windows.net/"
+}
+
+// localDir returns the absolute, slash separated path of a directory.
+func localDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%v is not a directory", abs)
+	}
+	return filepath.ToSlash(abs), nil
+}
+
+// isSubPath reports whether path is root or inside root.
+func isSubPath(root, path string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
@@ -1,19 +1,141 @@
 package unsync
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/akinbezatoglu/s3ync/internal/config"
+	"github.com/akinbezatoglu/s3ync/internal/prompt"
+	"github.com/akinbezatoglu/s3ync/internal/service/backend"
+	serviceconfig "github.com/akinbezatoglu/s3ync/internal/service/config"
+	"github.com/akinbezatoglu/s3ync/internal/service/control"
+	"github.com/akinbezatoglu/s3ync/internal/service/state"
+	"github.com/akinbezatoglu/s3ync/internal/service/storage"
 	"github.com/spf13/cobra"
 )
 
 func NewCmdUnsync(cfg config.Config) *cobra.Command {
+	var local, bucket, profile string
+	var purge, yes bool
 	var cmd = &cobra.Command{
 		Use:  "unsync",
 		Long: ``,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("s3ync unsync")
+			if local == "" || bucket == "" {
+				fmt.Println("both --local and --bucket are required")
+				os.Exit(1)
+			}
+			abs, err := filepath.Abs(local)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			path := filepath.ToSlash(abs)
+			if !isSynced(cfg, profile, path, bucket) {
+				fmt.Printf("%v is not synced with the bucket %v (profile: %v)\n", path, bucket, profile)
+				os.Exit(1)
+			}
+			// The sync and the keys of its objects are read before the sync is removed, the service forgets them after.
+			var synced *serviceconfig.Sync
+			var keys []string
+			if purge {
+				all, err := serviceconfig.GetAllSyncList()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				synced = all.All[path]
+				if keys, err = syncedKeys(path); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			if purge && len(keys) != 0 && !yes && !prompt.Confirm(fmt.Sprintf(
+				"The %v objects uploaded from %v will be deleted from the bucket %v. The other objects of the bucket and its trash (%v) are kept. Are you sure?",
+				len(keys), path, bucket, synced.TrashPrefix)) {
+				fmt.Println("Aborted, nothing is changed.")
+				os.Exit(1)
+			}
+
+			if err := cfg.RemoveSync(profile, path); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			// Tell the running service to remove every watch under the root of the sync, it forgets its state.
+			// The state is removed here when the service is not running, so a later sync of the directory
+			// never takes the objects of the old bucket for its own.
+			var notRunning *control.ServiceNotRunningError
+			err = control.NewClient().RemoveSync(path)
+			if errors.As(err, &notRunning) {
+				err = state.DeleteSyncFile(state.StoreFile(), path)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Succesfully, %v is unsynced from the bucket %v (profile: %v)\n", path, bucket, profile)
+
+			if purge && len(keys) == 0 {
+				fmt.Printf("There is no object uploaded from %v to delete from the bucket %v\n", path, bucket)
+			} else if purge {
+				b, err := backend.NewPool().Get(synced)
+				if err == nil {
+					// Only the objects the sync uploaded are deleted, the bucket may have others.
+					err = b.Delete(keys)
+				}
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				fmt.Printf("Succesfully, the %v objects uploaded from %v are deleted from the bucket %v\n", len(keys), path, bucket)
+			}
 		},
 	}
+
+	cmd.Flags().StringVarP(&local, "local", "l", "", "Local directory to stop listening on")
+	cmd.Flags().StringVarP(&bucket, "bucket", "b", "", "Bucket the local directory is synced with")
+	cmd.Flags().StringVarP(&profile, "profile", "p", "default", "Profile of the bucket")
+	cmd.Flags().BoolVar(&purge, "purge", false, "Delete the objects uploaded from the directory from the bucket as well")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
 	return cmd
 }
+
+// isSynced reports whether the local path of the profile is synced with the bucket.
+func isSynced(cfg config.Config, profile, path, bucket string) bool {
+	syncs, err := cfg.GetSyncListFromProfile(profile)
+	if err != nil {
+		return false
+	}
+	for i := 0; i < len(syncs)/2; i++ {
+		if syncs[i*2] == path && (syncs[i*2+1] == bucket || isLocalTarget(syncs[i*2+1], bucket)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalTarget reports whether the bucket is the directory of a sync mirrored by the local backend,
+// which is stored as an absolute path.
+func isLocalTarget(target, bucket string) bool {
+	abs, err := filepath.Abs(bucket)
+	return err == nil && filepath.IsAbs(filepath.FromSlash(target)) && filepath.ToSlash(abs) == target
+}
+
+// syncedKeys returns the keys of the objects uploaded by the sync whose root is path. They are asked
+// to the running service, which holds the state database, or read from the database when it is not running.
+func syncedKeys(path string) ([]string, error) {
+	keys, err := control.NewClient().SyncedKeys(path)
+	var notRunning *control.ServiceNotRunningError
+	if !errors.As(err, &notRunning) {
+		return keys, err
+	}
+	store, err := state.Open(state.StoreFile())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return storage.SyncedKeys(store, path, "")
+}